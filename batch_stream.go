@@ -0,0 +1,104 @@
+package rocketmq
+
+import (
+	"context"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+// defaultStreamBufferSize is the SendBatchStream buffer depth unless
+// WithStreamBufferSize says otherwise.
+const defaultStreamBufferSize = 16
+
+// BatchSendResult is the outcome of one batch sent by SendBatchStream.
+// Results holds one entry per message sent, in batch order; when Err is set
+// it covers only the messages before the one that failed.
+type BatchSendResult struct {
+	Batch   []*primitive.Message
+	Results []*primitive.SendResult
+	Err     error
+}
+
+// SendBatchStream sends every batch received from batches through the
+// default producer and emits one BatchSendResult per batch, in order, on the
+// returned channel. Messages of a batch are sent one by one on the regular
+// send path, so each gets its own SendResult along with the producer's retry,
+// rate limit and namespace settings; the first failure ends its batch.
+//
+// Up to WithStreamBufferSize batches are read ahead of the broker; beyond
+// that the stream stops receiving, so a fast sender is held back. The
+// returned channel is closed once batches is closed and drained, or when ctx
+// is done, after which buffered batches are not sent and unread results are
+// dropped.
+func (r *Client) SendBatchStream(ctx context.Context, batches <-chan []*primitive.Message) <-chan BatchSendResult {
+	return r.SendBatchStreamWith(ctx, r.defaultProducerName(), batches)
+}
+
+// SendBatchStreamWith is SendBatchStream by producer instance name
+func (r *Client) SendBatchStreamWith(ctx context.Context, producerName string, batches <-chan []*primitive.Message) <-chan BatchSendResult {
+	size := r.producerOptions(producerName).streamBufferSize
+	if size <= 0 {
+		size = defaultStreamBufferSize
+	}
+	buffer := make(chan []*primitive.Message, size)
+	results := make(chan BatchSendResult, size)
+
+	go func() {
+		defer close(buffer)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case batch, ok := <-batches:
+				if !ok {
+					return
+				}
+				select {
+				case buffer <- batch:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	go func() {
+		defer close(results)
+		for batch := range buffer {
+			// Buffered batches are abandoned, not sent into certain failure.
+			if ctx.Err() != nil {
+				return
+			}
+			result := r.sendBatch(ctx, producerName, batch)
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return results
+}
+
+// sendBatch sends the messages of batch in order until one fails.
+func (r *Client) sendBatch(ctx context.Context, producerName string, batch []*primitive.Message) BatchSendResult {
+	result := BatchSendResult{Batch: batch, Results: make([]*primitive.SendResult, 0, len(batch))}
+	for _, msg := range batch {
+		if err := ctx.Err(); err != nil {
+			result.Err = err
+			return result
+		}
+		if msg == nil {
+			r.producerMetrics(producerName).IncrementProducerMessagesFailed()
+			result.Err = ErrInvalidMessage
+			return result
+		}
+		sendResult, err := r.sendSync(ctx, producerName, msg)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		result.Results = append(result.Results, sendResult)
+	}
+	return result
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/apache/rocketmq-client-go/v2"
@@ -35,6 +36,41 @@ type Client struct {
 	cancel       context.CancelFunc
 	metrics      *Metrics
 	retryHandler *RetryHandler
+
+	// Per-consumer options and runtime state, keyed by consumer name
+	consumerStates map[string]*consumerState
+	// Per-producer options and runtime state, keyed by producer name
+	producerStates map[string]*producerState
+	// Options passed to ConfigureProducer("") before a default producer
+	// started; the first producer to start takes them
+	defaultProducerOpts []ProducerOption
+
+	// Observers registered with ObserveProcessingTime
+	processingObservers []func(topic string, d time.Duration)
+
+	// draining is 1 while GracefulStop waits for in-flight sends to complete
+	draining int32
+	// inFlight counts sends registered by beginSend and not yet ended
+	inFlight int64
+}
+
+// addProducer registers a started producer. The first one becomes the
+// default producer and takes the options passed to ConfigureProducer("")
+// before it existed.
+func (r *Client) addProducer(name string, producer rocketmq.Producer, connMgr *ConnectionManager) {
+	state := r.producerState(name)
+	r.mu.Lock()
+	r.producers[name] = producer
+	if connMgr != nil {
+		r.prodConnMgrs[name] = connMgr
+	}
+	var pending []ProducerOption
+	if r.defaultProducer == "" {
+		r.defaultProducer = name
+		pending, r.defaultProducerOpts = r.defaultProducerOpts, nil
+	}
+	r.mu.Unlock()
+	state.apply(pending...)
 }
 
 // Ensure Client implements all interfaces
@@ -42,7 +78,8 @@ var _ ClientInterface = (*Client)(nil)
 var _ Producer = (*Client)(nil)
 var _ Consumer = (*Client)(nil)
 
-// NewRocketMQClient creates a new RocketMQ client plugin instance
+// NewRocketMQClient creates a new RocketMQ client plugin instance. Its metrics
+// use the options set by SetMetricsOptions.
 func NewRocketMQClient() *Client {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Client{
@@ -56,12 +93,15 @@ func NewRocketMQClient() *Client {
 		),
 		ctx:          ctx,
 		cancel:       cancel,
-		metrics:      NewMetrics(),
+		metrics:      newDefaultMetrics(),
 		retryHandler: NewRetryHandler(RetryConfig{MaxRetries: 3, BackoffTime: time.Second, MaxBackoff: 30 * time.Second}),
 		producers:    make(map[string]rocketmq.Producer),
 		consumers:    make(map[string]rocketmq.PushConsumer),
 		prodConnMgrs: make(map[string]*ConnectionManager),
 		consConnMgrs: make(map[string]*ConnectionManager),
+
+		consumerStates: make(map[string]*consumerState),
+		producerStates: make(map[string]*producerState),
 	}
 }
 
@@ -99,6 +139,7 @@ func (r *Client) startupTasksContext(ctx context.Context) (startErr error) {
 		return err
 	}
 	r.publishRuntimeContract(false, false)
+	atomic.StoreInt32(&r.draining, 0)
 
 	defer func() {
 		if startErr == nil {
@@ -110,7 +151,6 @@ func (r *Client) startupTasksContext(ctx context.Context) (startErr error) {
 	}()
 
 	// Initialize all enabled producer instances
-	var firstProducerName string
 	for _, p := range r.conf.Producers {
 		if p == nil || !p.Enabled {
 			continue
@@ -135,14 +175,7 @@ func (r *Client) startupTasksContext(ctx context.Context) (startErr error) {
 			return WrapError(err, "failed to start producer connection manager: "+name)
 		}
 
-		r.mu.Lock()
-		r.producers[name] = producer
-		r.prodConnMgrs[name] = connMgr
-		if firstProducerName == "" {
-			firstProducerName = name
-			r.defaultProducer = name
-		}
-		r.mu.Unlock()
+		r.addProducer(name, producer, connMgr)
 	}
 
 	// Initialize all enabled consumer instances
@@ -237,6 +270,66 @@ func (r *Client) ShutdownTasks() error {
 	return r.shutdownTasksContext(context.Background())
 }
 
+// gracefulStopPollInterval is how often GracefulStop checks for in-flight
+// sends.
+const gracefulStopPollInterval = 10 * time.Millisecond
+
+// GracefulStop stops accepting sends, waits for those already in flight
+// (sync sends to return and async sends to run their callbacks), then shuts
+// the client down like ShutdownTasks. If ctx expires first it returns
+// ErrShutdownPending and leaves the client running, still rejecting new
+// sends, so the caller can retry or force shutdown.
+func (r *Client) GracefulStop(ctx context.Context) error {
+	atomic.StoreInt32(&r.draining, 1)
+
+	ticker := time.NewTicker(gracefulStopPollInterval)
+	defer ticker.Stop()
+	for {
+		n := int(atomic.LoadInt64(&r.inFlight))
+		if n == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			log.Warn("RocketMQ graceful stop interrupted", "pending", n, "error", ctx.Err())
+			return &ErrShutdownPending{Count: n}
+		case <-ticker.C:
+		}
+	}
+	return r.shutdownTasksContext(ctx)
+}
+
+// beginSend registers a send with GracefulStop. It reports false, without
+// registering, once the client is draining; otherwise the caller must call
+// endSend when the send completes. The send is registered before draining
+// is checked, and GracefulStop sets draining before counting, so either
+// GracefulStop waits for the send or the send is rejected.
+func (r *Client) beginSend() bool {
+	atomic.AddInt64(&r.inFlight, 1)
+	if atomic.LoadInt32(&r.draining) == 1 {
+		r.endSend()
+		return false
+	}
+	return true
+}
+
+// endSend ends a send registered by beginSend.
+func (r *Client) endSend() {
+	atomic.AddInt64(&r.inFlight, -1)
+}
+
+// PendingCallbackCount returns the number of async sends, across all
+// producer instances, whose callbacks have not run yet.
+func (r *Client) PendingCallbackCount() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var n int64
+	for _, state := range r.producerStates {
+		n += atomic.LoadInt64(&state.pending)
+	}
+	return int(n)
+}
+
 func (r *Client) shutdownTasksContext(ctx context.Context) error {
 	if err := ctx.Err(); err != nil {
 		return err
@@ -254,6 +347,8 @@ func (r *Client) shutdownTasksContext(ctx context.Context) error {
 	r.consConnMgrs = make(map[string]*ConnectionManager)
 	r.producers = make(map[string]rocketmq.Producer)
 	r.consumers = make(map[string]rocketmq.PushConsumer)
+	r.consumerStates = make(map[string]*consumerState)
+	r.producerStates = make(map[string]*producerState)
 	r.defaultProducer = ""
 	r.defaultConsumer = ""
 	cancel := r.cancel
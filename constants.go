@@ -25,6 +25,13 @@ const (
 	ConsumeOrderConcurrent = "CONCURRENTLY"
 	ConsumeOrderOrderly    = "ORDERLY"
 
+	// Message properties read by routers
+	PropertyContentType = "Content-Type"
+	PropertyMessageType = "Message-Type"
+
+	// PropertyCorrelationID is the message property carrying the correlation ID
+	PropertyCorrelationID = "X-Correlation-ID"
+
 	// Default group names
 	defaultProducerGroup = "lynx-producer-group"
 	defaultConsumerGroup = "lynx-consumer-group"
@@ -2,25 +2,36 @@ package rocketmq
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"runtime/debug"
+	"runtime/trace"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/apache/rocketmq-client-go/v2"
 	"github.com/apache/rocketmq-client-go/v2/consumer"
 	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-lynx/lynx-rocketmq/internal/msgcopy"
 	"github.com/go-lynx/lynx/log"
 )
 
 // Subscribe subscribes to topics and sets message handler
-func (r *Client) Subscribe(ctx context.Context, topics []string, handler MessageHandler) error {
-	return r.SubscribeWith(ctx, r.defaultConsumer, topics, handler)
+func (r *Client) Subscribe(ctx context.Context, topics []string, handler MessageHandler, opts ...ConsumerOption) error {
+	return r.SubscribeWith(ctx, r.defaultConsumerName(), topics, handler, opts...)
 }
 
 // SubscribeWith subscribes by consumer instance name
-func (r *Client) SubscribeWith(ctx context.Context, consumerName string, topics []string, handler MessageHandler) error {
+func (r *Client) SubscribeWith(ctx context.Context, consumerName string, topics []string, handler MessageHandler, opts ...ConsumerOption) error {
 	start := time.Now()
+	instance := consumerName
 	defer func() {
-		r.metrics.RecordConsumerLatency(time.Since(start))
+		r.metrics.forInstance(instance).RecordConsumerLatency(time.Since(start))
 	}()
 
 	if len(topics) == 0 {
@@ -42,63 +53,428 @@ func (r *Client) SubscribeWith(ctx context.Context, consumerName string, topics
 		return err
 	}
 
-	// Shared callback for all topics.
-	// A panic inside the user-supplied handler is recovered so that the broker
-	// is instructed to redeliver the message rather than losing it silently.
-	// A handler error causes ConsumeRetryLater (dead-letter logic is handled by
-	// the broker after MaxReconsumeTimes is exceeded).
-	consumeCallback := func(ctx context.Context, msgs ...*primitive.MessageExt) (result consumer.ConsumeResult, cbErr error) {
+	state := r.consumerState(consumerName)
+	if err := state.apply(opts...); err != nil {
+		return err
+	}
+	consumeCallback := r.newConsumeCallback(state, handler)
+	instance = state.options().instance(consumerName)
+
+	// Subscribe to every topic (each topic requires a separate Subscribe call)
+	for _, topic := range topics {
+		err = consumerClient.Subscribe(topic, consumer.MessageSelector{}, consumeCallback)
+		if err != nil {
+			log.Error("Failed to subscribe to RocketMQ topic", "consumer", consumerName, "instance", instance, "topic", topic, "error", err)
+			return WrapError(err, "failed to subscribe to topic: "+topic)
+		}
+		state.addTopic(topic)
+	}
+
+	if err := consumerClient.Start(); err != nil {
+		log.Error("Failed to start RocketMQ consumer", "consumer", consumerName, "instance", instance, "error", err)
+		return WrapError(err, "failed to start consumer")
+	}
+
+	log.Info("Subscribed to RocketMQ topics", "consumer", consumerName, "instance", instance, "topics", topics)
+	return nil
+}
+
+// newConsumeCallback builds the callback shared by all topics of a consumer.
+// A panic inside the user-supplied handler is recovered so that the broker
+// is instructed to redeliver the message rather than losing it silently.
+// A handler error causes ConsumeRetryLater (dead-letter logic is handled by
+// the broker after MaxReconsumeTimes is exceeded).
+func (r *Client) newConsumeCallback(state *consumerState, handler MessageHandler) func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+	consumerName := state.name
+	return func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		ctx = context.WithValue(ctx, receivedAtKey{}, time.Now())
+		opts := state.options()
+		instance := opts.instance(consumerName)
+		metrics := r.metrics.forInstance(instance)
 		for _, msg := range msgs {
 			start := time.Now()
 
-			func() {
-				defer func() {
-					if rec := recover(); rec != nil {
-						r.metrics.IncrementConsumerMessagesFailed()
-						log.Error("Panic in RocketMQ message handler", "consumer", consumerName, "topic", msg.Topic, "panic", rec)
-						result = consumer.ConsumeRetryLater
-						cbErr = fmt.Errorf("handler panic: %v", rec)
+			// Guards against broker-side routing bugs delivering foreign topics.
+			if err := state.checkTopic(msg.Topic); err != nil {
+				metrics.IncrementTopicMismatch()
+				metrics.IncrementConsumerMessagesFailed()
+				log.Error("Received RocketMQ message for unsubscribed topic", "consumer", consumerName, "instance", instance, "topic", msg.Topic, "msgId", msg.MsgId, "offsetMsgId", msg.OffsetMsgId, "error", err)
+				logAck(state, opts, msg, consumer.ConsumeRetryLater, err)
+				return consumer.ConsumeRetryLater, err
+			}
+
+			var fingerprint uint64
+			if opts.fingerprintDedup > 0 {
+				fingerprint = messageFingerprint(msg)
+				if state.fingerprints.contains(fingerprint) {
+					metrics.IncrementFingerprintCacheHit()
+					log.Debug("Skipping duplicate RocketMQ message", "consumer", consumerName, "instance", instance, "topic", msg.Topic, "msgId", msg.MsgId)
+					logAck(state, opts, msg, consumer.ConsumeSuccess, nil)
+					continue
+				}
+				metrics.IncrementFingerprintCacheMiss()
+			}
+
+			if len(opts.decoders) > 0 {
+				decoded, err := decodeMessage(opts.decoders, msg)
+				if err != nil {
+					if opts.onDecodeError != nil {
+						opts.onDecodeError(ctx, msg, err)
 					}
-				}()
-
-				if err := handler(ctx, msg); err != nil {
-					r.metrics.IncrementConsumerMessagesFailed()
-					log.Error("Failed to process RocketMQ message", "consumer", consumerName, "topic", msg.Topic, "error", err)
-					result = consumer.ConsumeRetryLater
-					cbErr = err
-					return
+					routeToDLQ(ctx)
+					metrics.IncrementConsumerMessagesFailed()
+					log.Error("Failed to decode RocketMQ message", "consumer", consumerName, "instance", instance, "topic", msg.Topic, "msgId", msg.MsgId, "error", err)
+					logAck(state, opts, msg, consumer.ConsumeRetryLater, err)
+					return consumer.ConsumeRetryLater, err
+				}
+				msg = decoded
+			}
+
+			// Register before invoking the handler: it may hand the message
+			// to async work that acks before the handler even returns.
+			var ack chan consumer.ConsumeResult
+			if opts.manualAck {
+				ack = state.expectAck(msg)
+			}
+
+			handlerCtx, endTask := startMessageTask(ctx, opts, msg)
+			handlerStart := time.Now()
+			err := r.invokeHandler(handlerCtx, consumerName, opts, handler, msg)
+			r.observeProcessingTime(msg.Topic, time.Since(handlerStart))
+			endTask()
+			if err != nil {
+				if ack != nil {
+					state.cancelAck(msg)
+				}
+				var retryAfter *RetryAfterError
+				if opts.timeoutEscalationThreshold > 0 && isTimeoutError(err) &&
+					int(msg.ReconsumeTimes) > opts.timeoutEscalationThreshold && routeToDLQ(ctx) {
+					log.Warn("Escalating repeatedly timed-out RocketMQ message to DLQ", "consumer", consumerName, "instance", instance, "topic", msg.Topic, "msgId", msg.MsgId, "reconsumeTimes", msg.ReconsumeTimes)
+				} else if int(msg.ReconsumeTimes) >= opts.maxRetries && routeToDLQ(ctx) {
+					atomic.AddInt64(&state.retryExhausted, 1)
+					log.Warn("RocketMQ message exceeded max retries, routing to DLQ", "consumer", consumerName, "instance", instance, "topic", msg.Topic, "msgId", msg.MsgId, "reconsumeTimes", msg.ReconsumeTimes, "maxRetries", opts.maxRetries)
+				} else if errors.As(err, &retryAfter) {
+					applyRetryAfter(ctx, retryAfter.Delay)
+				} else if opts.retryJitter > 0 {
+					applyRetryJitter(ctx, msg, opts.retryJitter)
 				}
+				metrics.IncrementConsumerMessagesFailed()
+				logAck(state, opts, msg, consumer.ConsumeRetryLater, err)
+				return consumer.ConsumeRetryLater, err
+			}
 
-				r.metrics.RecordConsumerLatency(time.Since(start))
-				r.metrics.IncrementConsumerMessagesReceived()
-				log.Debug("Processed RocketMQ message", "consumer", consumerName, "topic", msg.Topic, "msgId", msg.MsgId)
-			}()
+			if ack != nil {
+				outcome, err := state.awaitAck(ctx, msg, ack, opts.manualAckTimeout)
+				if err != nil || outcome != consumer.ConsumeSuccess {
+					metrics.IncrementConsumerMessagesFailed()
+					log.Warn("RocketMQ message not acknowledged", "consumer", consumerName, "instance", instance, "topic", msg.Topic, "msgId", msg.MsgId, "outcome", outcome, "error", err)
+					logAck(state, opts, msg, consumer.ConsumeRetryLater, err)
+					return consumer.ConsumeRetryLater, err
+				}
+			}
 
-			if cbErr != nil {
-				return result, cbErr
+			metrics.RecordConsumerLatency(time.Since(start))
+			metrics.IncrementConsumerMessagesReceived()
+			log.Debug("Processed RocketMQ message", "consumer", consumerName, "instance", instance, "topic", msg.Topic, "msgId", msg.MsgId)
+			logAck(state, opts, msg, consumer.ConsumeSuccess, nil)
+			if opts.fingerprintDedup > 0 {
+				state.fingerprints.add(fingerprint, opts.fingerprintDedup)
+			}
+			state.rate.add(time.Now())
+			if opts.logEvery > 0 {
+				if count, rate, due := state.recordProcessed(msg.Topic, opts.logEvery, time.Now()); due {
+					log.Info("Processed RocketMQ messages", "consumer", consumerName, "instance", instance,
+						"count", count, "topic", msg.Topic, "group", consumerGroup(ctx), "rate", rate)
+				}
 			}
 		}
 		return consumer.ConsumeSuccess, nil
 	}
+}
 
-	// Subscribe to every topic (each topic requires a separate Subscribe call)
-	for _, topic := range topics {
-		err = consumerClient.Subscribe(topic, consumer.MessageSelector{}, consumeCallback)
-		if err != nil {
-			log.Error("Failed to subscribe to RocketMQ topic", "consumer", consumerName, "topic", topic, "error", err)
-			return WrapError(err, "failed to subscribe to topic: "+topic)
+// messageFingerprint hashes the topic and raw body of msg.
+func messageFingerprint(msg *primitive.MessageExt) uint64 {
+	d := xxhash.New()
+	_, _ = d.WriteString(msg.Topic)
+	_, _ = d.Write([]byte{0})
+	_, _ = d.Write(msg.Body)
+	return d.Sum64()
+}
+
+// decodeMessage returns a copy of msg whose body is the output of the first
+// decoder that accepts it.
+func decodeMessage(decoders []Decoder, msg *primitive.MessageExt) (*primitive.MessageExt, error) {
+	var err error
+	for _, decode := range decoders {
+		body, decodeErr := decode(msg.Body)
+		if decodeErr != nil {
+			err = decodeErr
+			continue
 		}
+		clone := msgcopy.Ext(msg)
+		clone.Body = body
+		return clone, nil
 	}
+	return nil, WrapError(ErrInvalidMessage, fmt.Sprintf("failed to decode message: %v", err))
+}
 
-	if err := consumerClient.Start(); err != nil {
-		log.Error("Failed to start RocketMQ consumer", "consumer", consumerName, "error", err)
-		return WrapError(err, "failed to start consumer")
-	}
+// receivedAtKey is the context key of the time a message batch was handed
+// to the consume callback.
+type receivedAtKey struct{}
+
+// MessageReceivedAt returns the local time, with its monotonic clock reading,
+// at which the consume callback received the batch holding the message being
+// handled. This is after the SDK has pulled and buffered the message, so it
+// excludes time spent in the SDK's process queue. Unlike BornTimestamp it is
+// not subject to clock skew between producer and consumer hosts, so
+// time.Since(receivedAt) measures local processing time accurately. ok is
+// false when ctx does not come from a consume callback.
+func MessageReceivedAt(ctx context.Context) (receivedAt time.Time, ok bool) {
+	receivedAt, ok = ctx.Value(receivedAtKey{}).(time.Time)
+	return receivedAt, ok
+}
+
+// panicDumpWriter receives WithPanicDumpToStderr output; tests replace it.
+var panicDumpWriter io.Writer = os.Stderr
+
+// invokeHandler runs handler for one message, converting a panic into an error.
+func (r *Client) invokeHandler(ctx context.Context, consumerName string, opts consumerOptions, handler MessageHandler, msg *primitive.MessageExt) (err error) {
+	instance := opts.instance(consumerName)
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Error("Panic in RocketMQ message handler", "consumer", consumerName, "instance", instance, "topic", msg.Topic, "panic", rec)
+			if opts.panicDumpToStderr {
+				_, _ = fmt.Fprintf(panicDumpWriter, "rocketmq: panic in message handler (consumer=%s topic=%s msgId=%s): %v\n%s",
+					instance, msg.Topic, msg.MsgId, rec, debug.Stack())
+			}
+			err = fmt.Errorf("handler panic: %v", rec)
+		}
+	}()
 
-	log.Info("Subscribed to RocketMQ topics", "consumer", consumerName, "topics", topics)
+	if err := handler(ctx, msg); err != nil {
+		log.Error("Failed to process RocketMQ message", "consumer", consumerName, "instance", instance, "topic", msg.Topic, "error", err)
+		return err
+	}
 	return nil
 }
 
+// ObserveProcessingTime registers fn to be called after every handler
+// invocation, on any consumer, with the handler's wall-clock duration. It is
+// a lightweight alternative to wrapping handlers when only timing is needed.
+// Observers run on the consume goroutine and must not block.
+func (r *Client) ObserveProcessingTime(fn func(topic string, d time.Duration)) {
+	if fn == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.processingObservers = append(r.processingObservers, fn)
+}
+
+// observeProcessingTime notifies the ObserveProcessingTime observers.
+func (r *Client) observeProcessingTime(topic string, d time.Duration) {
+	r.mu.RLock()
+	observers := r.processingObservers
+	r.mu.RUnlock()
+
+	for _, fn := range observers {
+		fn(topic, d)
+	}
+}
+
+// startMessageTask starts a runtime/trace task for msg when WithTracing is
+// enabled. The returned func ends the task.
+func startMessageTask(ctx context.Context, opts consumerOptions, msg *primitive.MessageExt) (context.Context, func()) {
+	if !opts.tracing {
+		return ctx, func() {}
+	}
+	ctx, task := trace.NewTask(ctx, "rocketmq:message:"+msg.Topic)
+	trace.Log(ctx, "message.attempt", strconv.Itoa(int(msg.ReconsumeTimes)+1))
+	return ctx, task.End
+}
+
+// consumerGroup returns the consumer group of the consume callback ctx, or
+// "unknown" outside a callback.
+func consumerGroup(ctx context.Context) string {
+	if consumeCtx, ok := primitive.GetConsumerCtx(ctx); ok && consumeCtx.ConsumerGroup != "" {
+		return consumeCtx.ConsumerGroup
+	}
+	return "unknown"
+}
+
+// logAck records the ack decision for msg in Last100Errors when it is a nack
+// or WithAckLogging is enabled, and logs it when WithAckLogging is enabled.
+func logAck(state *consumerState, opts consumerOptions, msg *primitive.MessageExt, result consumer.ConsumeResult, err error) {
+	if !opts.ackLogging && result == consumer.ConsumeSuccess {
+		return
+	}
+	rec := AckRecord{
+		At:            time.Now(),
+		Topic:         msg.Topic,
+		MsgID:         msg.MsgId,
+		CorrelationID: msg.GetProperty(PropertyCorrelationID),
+		Result:        result,
+		Attempt:       msg.ReconsumeTimes + 1,
+		Err:           err,
+	}
+	state.recentAcks.add(rec)
+	if !opts.ackLogging {
+		return
+	}
+	action := "ack"
+	if result != consumer.ConsumeSuccess {
+		action = "nack"
+	}
+	log.Debug("RocketMQ message "+action, "consumer", state.name, "instance", opts.instance(state.name), "topic", rec.Topic, "msgId", rec.MsgID,
+		"correlationId", rec.CorrelationID, "result", result, "attempt", rec.Attempt)
+}
+
+// AckManually commits the outcome of a message consumed by a consumer
+// subscribed WithManualAck. ConsumeSuccess acks the message; any other outcome
+// hands it back to the broker for retry. msg must be the message passed to
+// the handler: each delivery, including a redelivered copy with the same
+// MsgId, is acked on its own.
+func (r *Client) AckManually(msg *primitive.MessageExt, outcome consumer.ConsumeResult) error {
+	if msg == nil {
+		return ErrInvalidMessage
+	}
+
+	r.mu.RLock()
+	states := make([]*consumerState, 0, len(r.consumerStates))
+	for _, state := range r.consumerStates {
+		states = append(states, state)
+	}
+	r.mu.RUnlock()
+
+	manual := false
+	for _, state := range states {
+		if !state.options().manualAck {
+			continue
+		}
+		manual = true
+		if state.resolveAck(msg, outcome) {
+			return nil
+		}
+	}
+
+	if !manual {
+		return ErrAutoAckEnabled
+	}
+	return WrapError(ErrAckNotPending, "message "+msg.MsgId)
+}
+
+// applyRetryJitter sets the delay level of the next redelivery to a random
+// level between the broker's default level for msg and the highest level
+// within maxJitter of it. Brokers only support fixed levels, so jittering the
+// delay and rounding it would collapse small jitters back onto the default
+// level; the range always spans at least the next level up instead.
+func applyRetryJitter(ctx context.Context, msg *primitive.MessageExt, maxJitter time.Duration) {
+	concurrentCtx, ok := primitive.GetConcurrentlyCtx(ctx)
+	if !ok || concurrentCtx.DelayLevelWhenNextConsume < 0 {
+		return
+	}
+	// Without an explicit level the broker retries at level 3 + reconsumeTimes.
+	level := min(3+int(msg.ReconsumeTimes), len(delayLevels))
+	highest := min(level+1, len(delayLevels))
+	for highest < len(delayLevels) && delayLevels[highest] <= delayLevels[level-1]+maxJitter {
+		highest++
+	}
+	concurrentCtx.DelayLevelWhenNextConsume = level + rand.IntN(highest-level+1)
+}
+
+// ConsumeRetryAfter returns an error that, returned from a MessageHandler
+// (directly or wrapped), retries the message after d instead of the broker's
+// default backoff or WithRetryJitter, e.g. honouring a downstream 429's
+// Retry-After. d is rounded to the nearest broker delay level (1s to 2h). Max
+// retry and timeout escalation still route the message to the DLQ first.
+// Only concurrent consumers can set a retry delay.
+func ConsumeRetryAfter(d time.Duration) error {
+	return &RetryAfterError{Delay: d}
+}
+
+// applyRetryAfter sets the delay level of the next redelivery to the level
+// nearest d.
+func applyRetryAfter(ctx context.Context, d time.Duration) {
+	concurrentCtx, ok := primitive.GetConcurrentlyCtx(ctx)
+	if !ok || concurrentCtx.DelayLevelWhenNextConsume < 0 {
+		return
+	}
+	concurrentCtx.DelayLevelWhenNextConsume = nearestDelayLevel(d)
+}
+
+// routeToDLQ asks the SDK to send the messages of the current concurrent
+// consume batch straight to the DLQ instead of scheduling a retry. It only
+// takes effect when the callback returns ConsumeRetryLater; orderly consumers
+// have no DLQ path and report false.
+func routeToDLQ(ctx context.Context) bool {
+	concurrentCtx, ok := primitive.GetConcurrentlyCtx(ctx)
+	if !ok {
+		return false
+	}
+	concurrentCtx.DelayLevelWhenNextConsume = -1
+	return true
+}
+
+// Topics returns the distinct topics the named consumer is subscribed to, in
+// sorted order, e.g. to pre-declare per-topic Prometheus series. An empty
+// name resolves to the default consumer; an unknown name has no topics.
+func (r *Client) Topics(consumerName string) []string {
+	state := r.lookupConsumerState(consumerName)
+	if state == nil {
+		return nil
+	}
+	return state.subscribedTopics()
+}
+
+// MaxRetries returns the number of redeliveries after which a failing message
+// of the named consumer is routed to the DLQ; see WithMaxRetries. An empty
+// name resolves to the default consumer; an unknown name reports 0.
+func (r *Client) MaxRetries(consumerName string) int {
+	state := r.lookupConsumerState(consumerName)
+	if state == nil {
+		return 0
+	}
+	return state.options().maxRetries
+}
+
+// RetryExhaustedCount returns how many messages of the named consumer failed
+// after MaxRetries redeliveries and were routed to the DLQ. A steadily rising
+// count usually means the retry policy is too tight for the handler's failure
+// mode. An empty name resolves to the default consumer; an unknown name
+// reports 0.
+func (r *Client) RetryExhaustedCount(consumerName string) int64 {
+	state := r.lookupConsumerState(consumerName)
+	if state == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&state.retryExhausted)
+}
+
+// Last100Errors returns the last 100 nacked messages of the named consumer,
+// oldest first, to aid debugging of message-level issues. With
+// WithAckLogging acks are kept too. An empty name resolves to the default
+// consumer; an unknown name reports nil.
+func (r *Client) Last100Errors(consumerName string) []AckRecord {
+	state := r.lookupConsumerState(consumerName)
+	if state == nil {
+		return nil
+	}
+	return state.recentAcks.snapshot()
+}
+
+// MessageRateWindow returns the average number of messages per second the
+// named consumer processed successfully over the last d, for autoscalers
+// that need current throughput without a metrics backend. d is rounded up to
+// whole seconds and capped at five minutes. An empty name resolves to the
+// default consumer; an unknown name reports 0.
+func (r *Client) MessageRateWindow(consumerName string, d time.Duration) float64 {
+	state := r.lookupConsumerState(consumerName)
+	if state == nil {
+		return 0
+	}
+	return state.rate.perSecond(time.Now(), d)
+}
+
 // GetConsumer gets the underlying consumer client
 func (r *Client) GetConsumer(name string) (rocketmq.PushConsumer, error) {
 	r.mu.RLock()
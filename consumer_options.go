@@ -0,0 +1,234 @@
+package rocketmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+// defaultManualAckTimeout bounds how long a consume goroutine waits for
+// AckManually before the message is handed back to the broker for retry,
+// unless WithManualAckTimeout says otherwise.
+const defaultManualAckTimeout = 30 * time.Second
+
+// defaultConsumerMaxRetries matches the SDK's MaxReconsumeTimes default for
+// concurrent consumers, after which the broker moves a message to the DLQ.
+// The plugin does not override that default, so it is also the highest
+// WithMaxRetries value that can take effect.
+const defaultConsumerMaxRetries = 16
+
+// ConsumerOption configures how a consumer instance processes messages. Options
+// are passed to Subscribe/SubscribeWith and apply to every topic of that
+// consumer.
+type ConsumerOption func(*consumerOptions)
+
+// consumerOptions holds the per-consumer settings read by the consume callback.
+type consumerOptions struct {
+	manualAck        bool
+	manualAckTimeout time.Duration
+
+	// timeoutEscalationThreshold routes a timed-out message to the DLQ once it
+	// has been redelivered more than this many times; 0 disables escalation.
+	timeoutEscalationThreshold int
+
+	// ackLogging logs every ack and nack decision at debug level.
+	ackLogging bool
+
+	// tracing wraps each handler invocation in a runtime/trace task.
+	tracing bool
+
+	// retryJitter is the maximum random delay added to a retry.
+	retryJitter time.Duration
+
+	// instanceName labels the consumer in log lines and metrics.
+	instanceName string
+
+	// panicDumpToStderr writes recovered handler panics to os.Stderr.
+	panicDumpToStderr bool
+
+	// maxRetries is the number of redeliveries before a failing message is
+	// routed to the DLQ.
+	maxRetries int
+
+	// logEvery logs a throughput line every n processed messages per topic.
+	logEvery int64
+
+	// fingerprintDedup is the number of recent body fingerprints checked to
+	// skip duplicates; 0 disables the check.
+	fingerprintDedup int
+
+	// decoders are tried in order on each message body before the handler
+	// runs; onDecodeError is called when all of them fail.
+	decoders      []Decoder
+	onDecodeError func(ctx context.Context, raw *primitive.MessageExt, err error)
+}
+
+// validate reports options that cannot take effect.
+func (o consumerOptions) validate() error {
+	if o.manualAckTimeout <= 0 {
+		return WrapError(ErrInvalidConfiguration, fmt.Sprintf("manual ack timeout %s is not positive", o.manualAckTimeout))
+	}
+	if o.maxRetries < 0 || o.maxRetries > defaultConsumerMaxRetries {
+		return WrapError(ErrInvalidConfiguration, fmt.Sprintf("max retries %d outside [0, %d]", o.maxRetries, defaultConsumerMaxRetries))
+	}
+	return nil
+}
+
+func defaultConsumerOptions() consumerOptions {
+	return consumerOptions{
+		manualAckTimeout: defaultManualAckTimeout,
+		maxRetries:       defaultConsumerMaxRetries,
+	}
+}
+
+// WithManualAck defers the ack decision until AckManually is called for the
+// message, which may happen after the handler has returned. The consume
+// goroutine stays blocked until then, so the wait is bounded by the manual
+// ack timeout (30s unless WithManualAckTimeout says otherwise), after which
+// the message is retried.
+func WithManualAck() ConsumerOption {
+	return func(o *consumerOptions) {
+		o.manualAck = true
+	}
+}
+
+// WithManualAckTimeout sets how long a WithManualAck consumer waits for
+// AckManually before retrying the message. Subscribe rejects d <= 0 with
+// ErrInvalidConfiguration.
+func WithManualAckTimeout(d time.Duration) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.manualAckTimeout = d
+	}
+}
+
+// WithTimeoutEscalationThreshold sends a message straight to the DLQ when its
+// handler times out and the message has already been redelivered more than n
+// times, so a stuck message stops occupying retry slots. A timeout is a
+// handler error matching context.DeadlineExceeded or reporting
+// Timeout() == true. n <= 0 disables escalation. Only concurrent consumers
+// can route to the DLQ.
+func WithTimeoutEscalationThreshold(n int) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.timeoutEscalationThreshold = n
+	}
+}
+
+// WithAckLogging logs each ack or nack decision at debug level together with
+// the message ID, its X-Correlation-ID property, the consume result, the
+// delivery attempt and the topic, and keeps acks as well as nacks in
+// Last100Errors. It is off by default.
+func WithAckLogging(enabled bool) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.ackLogging = enabled
+	}
+}
+
+// WithTracing wraps each handler invocation in a runtime/trace task named
+// "rocketmq:message:<topic>" and logs the delivery attempt, giving
+// message-level granularity in Go execution traces. It is off by default.
+func WithTracing(enabled bool) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.tracing = enabled
+	}
+}
+
+// WithRetryJitter spreads the redelivery of failed messages, so consumers
+// that fail together do not all retry at the same moment. Brokers only
+// support fixed delay levels, so each retry picks a random level between the
+// default one and the highest level at most maxJitter later, and always
+// considers at least the next level up: with maxJitter 1m a first retry
+// lands at 10s, 30s or 1m. Only concurrent consumers can set a retry delay.
+func WithRetryJitter(maxJitter time.Duration) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.retryJitter = maxJitter
+	}
+}
+
+// WithNamedConsumerInstance is the consumer counterpart of WithNamedInstance:
+// it sets the name that identifies the consumer in message log lines and in
+// the instance label of its Prometheus metrics. It defaults to the
+// consumer's configured name.
+func WithNamedConsumerInstance(name string) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.instanceName = name
+	}
+}
+
+// instance returns the instance name for log lines and metrics.
+func (o consumerOptions) instance(consumerName string) string {
+	if o.instanceName != "" {
+		return o.instanceName
+	}
+	return consumerName
+}
+
+// WithMaxRetries routes a message to the DLQ when its handler fails after it
+// has already been redelivered n times, instead of waiting for the broker's
+// own limit of 16. It can only lower that limit: Subscribe rejects n outside
+// [0, 16] with ErrInvalidConfiguration. Only concurrent consumers can route
+// to the DLQ.
+func WithMaxRetries(n int) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.maxRetries = n
+	}
+}
+
+// WithLogEvery logs an Info line every n successfully processed messages of a
+// topic, with the count, consumer group and rate in messages per second since
+// the previous line, giving a throughput readout in container logs without a
+// Prometheus scrape. n <= 0 disables it, which is the default.
+func WithLogEvery(n int64) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.logEvery = n
+	}
+}
+
+// WithFingerprintDedup skips, without invoking the handler, messages whose
+// topic and body match one of the last size successfully processed messages.
+// The xxhash fingerprint is computed on the raw body, so a redelivered
+// duplicate costs neither deserialization nor handler work. Messages that
+// legitimately repeat a body are skipped too, so only enable it for topics
+// whose bodies are unique, e.g. because they embed an event ID. size <= 0
+// disables it, which is the default.
+func WithFingerprintDedup(size int) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.fingerprintDedup = size
+	}
+}
+
+// Decoder converts a message body into the format the handler expects. It
+// returns an error when the body is not in the format it reads.
+type Decoder func(body []byte) ([]byte, error)
+
+// WithDecoderFallbackChain tries decoders in order on each message body until
+// one succeeds, and hands the handler a copy of the message carrying the
+// decoded body. It helps during format migrations, when a topic carries
+// messages in several encodings; a decoder that returns the current format
+// unchanged belongs first in the chain. When every decoder fails, the
+// WithDeserializationErrorHandler handler is called and the message is routed
+// to the DLQ without invoking the handler.
+func WithDecoderFallbackChain(decoders ...Decoder) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.decoders = append([]Decoder(nil), decoders...)
+	}
+}
+
+// WithDeserializationErrorHandler sets a handler called with the raw message
+// and the last decode error when no WithDecoderFallbackChain decoder can
+// decode a message, before the message is routed to the DLQ.
+func WithDeserializationErrorHandler(fn func(ctx context.Context, raw *primitive.MessageExt, err error)) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.onDecodeError = fn
+	}
+}
+
+// WithPanicDumpToStderr additionally writes recovered handler panics, with
+// their stack trace, to os.Stderr. It makes panics visible to operators who
+// watch stderr (e.g. via journalctl) when the logger writes to a file.
+func WithPanicDumpToStderr(enabled bool) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.panicDumpToStderr = enabled
+	}
+}
@@ -2,15 +2,166 @@ package rocketmq
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	rtrace "runtime/trace"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/apache/rocketmq-client-go/v2"
 	"github.com/apache/rocketmq-client-go/v2/consumer"
 	"github.com/apache/rocketmq-client-go/v2/primitive"
 	"github.com/go-lynx/lynx-rocketmq/conf"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
+// fakeProducer is an in-memory rocketmq.Producer for exercising the send path
+// without a broker. Methods not overridden panic via the nil embedded interface.
+type fakeProducer struct {
+	rocketmq.Producer
+
+	mu       sync.Mutex
+	sent     []*primitive.Message
+	sendSync func(ctx context.Context, msg *primitive.Message) (*primitive.SendResult, error)
+
+	// holdAsync defers async callbacks until completeAsync is called.
+	holdAsync bool
+	held      []func()
+
+	// shutdown is set once Shutdown has been called.
+	shutdown atomic.Bool
+}
+
+func (p *fakeProducer) SendSync(ctx context.Context, msgs ...*primitive.Message) (*primitive.SendResult, error) {
+	p.mu.Lock()
+	p.sent = append(p.sent, msgs...)
+	p.mu.Unlock()
+	if p.sendSync != nil {
+		return p.sendSync(ctx, msgs[0])
+	}
+	return &primitive.SendResult{Status: primitive.SendOK, MsgID: "msg-" + msgs[0].Topic}, nil
+}
+
+func (p *fakeProducer) SendAsync(ctx context.Context, callback func(context.Context, *primitive.SendResult, error), msgs ...*primitive.Message) error {
+	result, err := p.SendSync(ctx, msgs...)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.holdAsync {
+		p.held = append(p.held, func() { callback(ctx, result, err) })
+		return nil
+	}
+	callback(ctx, result, err)
+	return nil
+}
+
+// completeAsync runs the async callbacks held back by holdAsync.
+func (p *fakeProducer) completeAsync() {
+	p.mu.Lock()
+	held := p.held
+	p.held = nil
+	p.mu.Unlock()
+	for _, callback := range held {
+		callback()
+	}
+}
+
+func (p *fakeProducer) Shutdown() error {
+	p.shutdown.Store(true)
+	return nil
+}
+
+func (p *fakeProducer) sentMessages() []*primitive.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*primitive.Message(nil), p.sent...)
+}
+
+// fakePushConsumer is an in-memory rocketmq.PushConsumer that accepts
+// subscriptions and records their callbacks.
+type fakePushConsumer struct {
+	rocketmq.PushConsumer
+
+	callbacks    map[string]func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error)
+	subscribeErr error
+	startErr     error
+}
+
+func (c *fakePushConsumer) Subscribe(topic string, _ consumer.MessageSelector, f func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error)) error {
+	if c.callbacks == nil {
+		c.callbacks = make(map[string]func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error))
+	}
+	c.callbacks[topic] = f
+	return c.subscribeErr
+}
+
+func (c *fakePushConsumer) Start() error {
+	return c.startErr
+}
+
+// captureLogs returns what fn logs. The lynx logger is not initialized in
+// tests, so log lines go to its stderr fallback as fmt.Sprint of the
+// arguments, e.g. "consumerordersinstanceorders-blue".
+func captureLogs(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe failed: %v", err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+
+	fn()
+	os.Stderr = stderr
+	_ = w.Close()
+	return <-out
+}
+
+// newTestClientWithProducer returns a client whose default producer is fp,
+// with isolated metrics and fast retries.
+func newTestClientWithProducer(name string, fp *fakeProducer) *Client {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	client.retryHandler = NewRetryHandler(RetryConfig{MaxRetries: 2, BackoffTime: time.Millisecond, MaxBackoff: time.Millisecond})
+	client.addProducer(name, fp, nil)
+	return client
+}
+
+// recordingSpan is a span that reports itself as recording and keeps the
+// attributes set on it.
+type recordingSpan struct {
+	trace.Span
+	attrs map[attribute.Key]attribute.Value
+}
+
+func (s *recordingSpan) IsRecording() bool {
+	return true
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
 // buildTestConsumerCallback builds a consume callback exactly as SubscribeWith
 // does, so we can unit-test panic recovery and error handling without a live broker.
 func buildTestConsumerCallback(
@@ -235,3 +386,1510 @@ func TestGracefulShutdownNoInstances(t *testing.T) {
 		t.Fatal("expected lifecycle context to be cleared after shutdown")
 	}
 }
+
+func TestWeightedTopicSelector(t *testing.T) {
+	selector, err := NewWeightedTopicSelector(map[string]int{"orders-v1": 3, "orders-v2": 1, "orders-v3": 0})
+	if err != nil {
+		t.Fatalf("NewWeightedTopicSelector failed: %v", err)
+	}
+
+	weights := selector.Weights()
+	if len(weights) != 2 || weights["orders-v1"] != 3 || weights["orders-v2"] != 1 {
+		t.Fatalf("unexpected effective weights: %v", weights)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		counts[selector.Select()]++
+	}
+	if counts["orders-v3"] != 0 {
+		t.Fatalf("zero-weight topic was selected %d times", counts["orders-v3"])
+	}
+	if counts["orders-v1"] < 2*counts["orders-v2"] {
+		t.Fatalf("selection not proportional to weights: %v", counts)
+	}
+
+	if _, err := NewWeightedTopicSelector(map[string]int{"orders-v1": -1}); !errors.Is(err, ErrInvalidTopicWeight) {
+		t.Fatalf("expected ErrInvalidTopicWeight for negative weight, got %v", err)
+	}
+	if _, err := NewWeightedTopicSelector(map[string]int{"orders-v1": 0}); !errors.Is(err, ErrInvalidTopicWeight) {
+		t.Fatalf("expected ErrInvalidTopicWeight when all weights are zero, got %v", err)
+	}
+
+	var empty WeightedTopicSelector
+	if topic := empty.Select(); topic != "" {
+		t.Fatalf("expected empty topic from a zero-value selector, got %q", topic)
+	}
+}
+
+func TestProducerTopicSelector(t *testing.T) {
+	fp := &fakeProducer{}
+	client := newTestClientWithProducer("p1", fp)
+	selector, err := NewWeightedTopicSelector(map[string]int{"orders-v2": 1})
+	if err != nil {
+		t.Fatalf("NewWeightedTopicSelector failed: %v", err)
+	}
+	client.ConfigureProducer("", WithTopicSelector(selector))
+
+	routed := primitive.NewMessage("", []byte("a"))
+	if _, err := client.SendContext(context.Background(), routed); err != nil {
+		t.Fatalf("SendContext failed: %v", err)
+	}
+	if err := client.sendAsync(context.Background(), "", routed, nil); err != nil {
+		t.Fatalf("sendAsync failed: %v", err)
+	}
+	if _, err := client.SendContext(context.Background(), primitive.NewMessage("orders", []byte("b"))); err != nil {
+		t.Fatalf("SendContext failed: %v", err)
+	}
+
+	sent := fp.sentMessages()
+	if len(sent) != 3 || sent[0].Topic != "orders-v2" || sent[1].Topic != "orders-v2" || sent[2].Topic != "orders" {
+		t.Fatalf("unexpected topics sent: %v", sent)
+	}
+	if routed.Topic != "" {
+		t.Fatalf("caller's message was modified: topic %q", routed.Topic)
+	}
+}
+
+func TestSendContextSendsPreparedMessage(t *testing.T) {
+	fp := &fakeProducer{}
+	client := newTestClientWithProducer("orders", fp)
+
+	span := &recordingSpan{Span: noop.Span{}, attrs: make(map[attribute.Key]attribute.Value)}
+	ctx := trace.ContextWithSpan(context.Background(), span)
+
+	msg := primitive.NewMessage("order-events", []byte("created")).WithTag("created")
+	result, err := client.SendContext(ctx, msg)
+	if err != nil {
+		t.Fatalf("SendContext failed: %v", err)
+	}
+	if result.MsgID != "msg-order-events" {
+		t.Fatalf("unexpected send result: %+v", result)
+	}
+	if sent := fp.sentMessages(); len(sent) != 1 || sent[0] != msg {
+		t.Fatalf("expected prepared message to be sent as-is, got %v", sent)
+	}
+
+	for key, want := range map[attribute.Key]string{
+		"messaging.system":               "rocketmq",
+		"messaging.destination.name":     "order-events",
+		"messaging.rocketmq.message.tag": "created",
+		"messaging.message.id":           "msg-order-events",
+	} {
+		if got := span.attrs[key].AsString(); got != want {
+			t.Fatalf("span attribute %s = %q, want %q", key, got, want)
+		}
+	}
+
+	if s := client.metrics.GetStats(); s.ProducerSent != 1 || s.ProducerFailed != 0 {
+		t.Fatalf("unexpected producer metrics: sent=%d failed=%d", s.ProducerSent, s.ProducerFailed)
+	}
+}
+
+func TestSendContextRejectsNilMessage(t *testing.T) {
+	client := newTestClientWithProducer("orders", &fakeProducer{})
+
+	if _, err := client.SendContext(context.Background(), nil); !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrInvalidMessage, got %v", err)
+	}
+}
+
+func TestManualAckDefersOutcome(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	state.apply(WithManualAck())
+
+	msg := &primitive.MessageExt{Message: primitive.Message{Topic: "order-events"}, MsgId: "m-1"}
+	handler := func(_ context.Context, m *primitive.MessageExt) error {
+		// Ack from async work after the handler has returned.
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_ = client.AckManually(m, consumer.ConsumeSuccess)
+		}()
+		return nil
+	}
+
+	cb := client.newConsumeCallback(state, handler)
+	result, err := cb(context.Background(), msg)
+	if err != nil || result != consumer.ConsumeSuccess {
+		t.Fatalf("expected ConsumeSuccess after manual ack, got %v (err=%v)", result, err)
+	}
+	if s := client.metrics.GetStats(); s.ConsumerReceived != 1 {
+		t.Fatalf("expected 1 consumer received metric, got %d", s.ConsumerReceived)
+	}
+
+	if err := client.AckManually(msg, consumer.ConsumeSuccess); !errors.Is(err, ErrAckNotPending) {
+		t.Fatalf("expected ErrAckNotPending for an already acked message, got %v", err)
+	}
+}
+
+func TestManualAckTimeoutRetries(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	state.apply(WithManualAck(), WithManualAckTimeout(10*time.Millisecond))
+
+	cb := client.newConsumeCallback(state, func(context.Context, *primitive.MessageExt) error { return nil })
+	result, err := cb(context.Background(), &primitive.MessageExt{MsgId: "m-1"})
+
+	if result != consumer.ConsumeRetryLater || !errors.Is(err, ErrAckTimeout) {
+		t.Fatalf("expected ConsumeRetryLater with ErrAckTimeout, got %v (err=%v)", result, err)
+	}
+}
+
+func TestManualAckRedeliveredCopy(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	state.apply(WithManualAck(), WithManualAckTimeout(time.Second))
+
+	delivered := make(chan *primitive.MessageExt, 2)
+	cb := client.newConsumeCallback(state, func(_ context.Context, m *primitive.MessageExt) error {
+		delivered <- m
+		return nil
+	})
+
+	// Two deliveries of the same message, e.g. the original and a redelivery
+	// after a rebalance, await their acks concurrently.
+	first := &primitive.MessageExt{MsgId: "m-1"}
+	second := &primitive.MessageExt{MsgId: "m-1", ReconsumeTimes: 1}
+	results := make(chan consumer.ConsumeResult, 2)
+	for _, msg := range []*primitive.MessageExt{first, second} {
+		go func() {
+			result, _ := cb(context.Background(), msg)
+			results <- result
+		}()
+		<-delivered
+	}
+
+	if err := client.AckManually(second, consumer.ConsumeRetryLater); err != nil {
+		t.Fatalf("ack of the redelivered copy failed: %v", err)
+	}
+	if err := client.AckManually(first, consumer.ConsumeSuccess); err != nil {
+		t.Fatalf("ack of the first delivery failed: %v", err)
+	}
+	got := []consumer.ConsumeResult{<-results, <-results}
+	if !slices.Contains(got, consumer.ConsumeSuccess) || !slices.Contains(got, consumer.ConsumeRetryLater) {
+		t.Fatalf("expected each delivery to get its own outcome, got %v", got)
+	}
+
+	if err := state.apply(WithManualAckTimeout(0)); !errors.Is(err, ErrInvalidConfiguration) {
+		t.Fatalf("expected ErrInvalidConfiguration for a zero timeout, got %v", err)
+	}
+}
+
+func TestAckManuallyRequiresManualAck(t *testing.T) {
+	client := NewRocketMQClient()
+	client.consumerState("orders")
+
+	err := client.AckManually(&primitive.MessageExt{MsgId: "m-1"}, consumer.ConsumeSuccess)
+	if !errors.Is(err, ErrAutoAckEnabled) {
+		t.Fatalf("expected ErrAutoAckEnabled, got %v", err)
+	}
+}
+
+func TestTimeoutEscalationRoutesToDLQ(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	state.apply(WithTimeoutEscalationThreshold(2))
+
+	timeoutHandler := func(context.Context, *primitive.MessageExt) error {
+		return fmt.Errorf("call inventory: %w", context.DeadlineExceeded)
+	}
+	cb := client.newConsumeCallback(state, timeoutHandler)
+
+	for _, tc := range []struct {
+		reconsumeTimes int32
+		wantDelay      int
+	}{
+		{reconsumeTimes: 1, wantDelay: 0},
+		{reconsumeTimes: 2, wantDelay: 0},
+		{reconsumeTimes: 3, wantDelay: -1},
+	} {
+		ctx, concurrentCtx := newConcurrentlyContext()
+		msg := &primitive.MessageExt{MsgId: "m-1", ReconsumeTimes: tc.reconsumeTimes}
+
+		if result, _ := cb(ctx, msg); result != consumer.ConsumeRetryLater {
+			t.Fatalf("reconsumeTimes=%d: expected ConsumeRetryLater, got %v", tc.reconsumeTimes, result)
+		}
+		if concurrentCtx.DelayLevelWhenNextConsume != tc.wantDelay {
+			t.Fatalf("reconsumeTimes=%d: delay level = %d, want %d", tc.reconsumeTimes, concurrentCtx.DelayLevelWhenNextConsume, tc.wantDelay)
+		}
+	}
+}
+
+func TestProducerTopicRateLimit(t *testing.T) {
+	fp := &fakeProducer{}
+	client := newTestClientWithProducer("p1", fp)
+	client.ConfigureProducer("", WithRateLimit(1000), WithTopicRateLimit("orders", 1))
+
+	if err := client.SendMessage(context.Background(), "orders", []byte("a")); err != nil {
+		t.Fatalf("first send failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.SendMessage(ctx, "orders", []byte("b")); err == nil {
+		t.Fatal("expected second send to the limited topic to be rejected")
+	}
+	if err := client.SendMessage(ctx, "payments", []byte("c")); err != nil {
+		t.Fatalf("send to unlimited topic failed: %v", err)
+	}
+
+	if got := client.metrics.GetStats().ProducerSent; got != 2 {
+		t.Fatalf("expected 2 sent messages, got %d", got)
+	}
+}
+
+func TestConfigureProducerKeepsUnchangedLimits(t *testing.T) {
+	fp := &fakeProducer{holdAsync: true}
+	client := newTestClientWithProducer("p1", fp)
+	client.ConfigureProducer("", WithRateLimit(1), WithMaxPendingMessages(1))
+
+	if err := client.SendMessageAsync(context.Background(), "orders", []byte("a")); err != nil {
+		t.Fatalf("first send failed: %v", err)
+	}
+	client.ConfigureProducer("", WithHeaderConflictStrategy(PreferHeader))
+
+	// The token bucket and the in-flight slot both survive the unrelated
+	// reconfiguration, so the second send is held back.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.SendMessageAsync(ctx, "orders", []byte("b")); err == nil {
+		t.Fatal("expected the second send to be limited after an unrelated ConfigureProducer")
+	}
+	client.ConfigureProducer("", WithRateLimit(0))
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel2()
+	if err := client.SendMessageAsync(ctx2, "orders", []byte("c")); err == nil {
+		t.Fatal("expected the in-flight send to still hold the only pending slot")
+	}
+	if got := client.PendingCount(""); got != 1 {
+		t.Fatalf("expected 1 pending send, got %d", got)
+	}
+
+	client.ConfigureProducer("", WithMaxPendingMessages(2))
+	if err := client.SendMessageAsync(context.Background(), "orders", []byte("d")); err != nil {
+		t.Fatalf("expected a send once the limit is raised, got %v", err)
+	}
+	fp.completeAsync()
+}
+
+func TestFireAndForgetProducerReportsFailures(t *testing.T) {
+	sendErr := errors.New("broker unavailable")
+	fp := &fakeProducer{sendSync: func(_ context.Context, msg *primitive.Message) (*primitive.SendResult, error) {
+		if msg.Topic == "payments" {
+			return nil, sendErr
+		}
+		return &primitive.SendResult{Status: primitive.SendOK, MsgID: "msg-1"}, nil
+	}}
+	client := newTestClientWithProducer("p1", fp)
+
+	var failed []error
+	p := NewFireAndForgetProducer(client, "", WithErrorFn(func(_ *primitive.Message, err error) {
+		failed = append(failed, err)
+	}))
+	p.Publish(context.Background(), primitive.NewMessage("orders", []byte("a")))
+	p.Publish(context.Background(), primitive.NewMessage("payments", []byte("b")))
+	p.Publish(context.Background(), primitive.NewMessage("orders", nil))
+
+	if len(failed) != 2 || !errors.Is(failed[0], sendErr) || !errors.Is(failed[1], ErrEmptyMessage) {
+		t.Fatalf("unexpected reported errors: %v", failed)
+	}
+	stats := client.metrics.GetStats()
+	if stats.ProducerSent != 1 || stats.ProducerFailed != 2 {
+		t.Fatalf("expected 1 sent and 2 failed, got %d sent and %d failed", stats.ProducerSent, stats.ProducerFailed)
+	}
+}
+
+func TestSendAtRoundsToNearestDelayLevel(t *testing.T) {
+	fp := &fakeProducer{}
+	client := newTestClientWithProducer("p1", fp)
+
+	cases := []struct {
+		delay time.Duration
+		level int
+	}{
+		{0, 1},
+		{8 * time.Second, 3},
+		{90 * time.Second, 5},
+		{45 * time.Minute, 16},
+		{24 * time.Hour, 18},
+	}
+	for _, tc := range cases {
+		if got := nearestDelayLevel(tc.delay); got != tc.level {
+			t.Errorf("nearestDelayLevel(%s) = %d, want %d", tc.delay, got, tc.level)
+		}
+	}
+
+	msg := primitive.NewMessage("orders", []byte("a"))
+	if _, err := client.SendAt(context.Background(), msg, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("SendAt failed: %v", err)
+	}
+	if got := fp.sentMessages()[0].GetProperty(primitive.PropertyDelayTimeLevel); got != "5" {
+		t.Fatalf("expected delay level 5, got %q", got)
+	}
+
+	if _, err := client.SendAt(context.Background(), msg, time.Now().Add(-time.Second)); !errors.Is(err, ErrDeliveryTimeInPast) {
+		t.Fatalf("expected ErrDeliveryTimeInPast, got %v", err)
+	}
+}
+
+func TestSendAtWithTimerMessages(t *testing.T) {
+	fp := &fakeProducer{}
+	client := newTestClientWithProducer("p1", fp)
+	client.ConfigureProducer("", WithTimerMessages(true))
+
+	deliverAt := time.Now().Add(90 * time.Second)
+	if _, err := client.SendAt(context.Background(), primitive.NewMessage("orders", []byte("a")), deliverAt); err != nil {
+		t.Fatalf("SendAt failed: %v", err)
+	}
+
+	sent := fp.sentMessages()[0]
+	if got := sent.GetProperty(propertyTimerDeliverMs); got != fmt.Sprint(deliverAt.UnixMilli()) {
+		t.Fatalf("unexpected timer property %q", got)
+	}
+	if got := sent.GetProperty(primitive.PropertyDelayTimeLevel); got != "" {
+		t.Fatalf("timer messages should not set a delay level, got %q", got)
+	}
+}
+
+func TestProducerTopicNamespace(t *testing.T) {
+	var mu sync.Mutex
+	var physical []string
+	fp := &fakeProducer{sendSync: func(_ context.Context, msg *primitive.Message) (*primitive.SendResult, error) {
+		mu.Lock()
+		physical = append(physical, msg.Topic)
+		mu.Unlock()
+		if msg.Topic == "tenant-a%payments" {
+			return nil, fmt.Errorf("topic=%s route info not found", msg.Topic)
+		}
+		return &primitive.SendResult{Status: primitive.SendOK, MsgID: "msg-1", MessageQueue: &primitive.MessageQueue{Topic: msg.Topic}}, nil
+	}}
+	client := newTestClientWithProducer("p1", fp)
+	client.retryHandler = NewRetryHandler(RetryConfig{MaxRetries: 0})
+	client.ConfigureProducer("", WithTopicNamespace("tenant-a"))
+
+	msg := primitive.NewMessage("orders", []byte("a"))
+	result, err := client.SendContext(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("SendContext failed: %v", err)
+	}
+	if msg.Topic != "orders" {
+		t.Fatalf("expected caller's message to keep its logical topic, got %s", msg.Topic)
+	}
+	if result.MessageQueue.Topic != "orders" {
+		t.Fatalf("expected result queue topic without the namespace, got %s", result.MessageQueue.Topic)
+	}
+
+	err = client.SendMessage(context.Background(), "payments", []byte("b"))
+	if err == nil || strings.Contains(err.Error(), "tenant-a%") || !strings.Contains(err.Error(), "topic=payments") {
+		t.Fatalf("expected error with the namespace stripped, got %v", err)
+	}
+
+	if len(physical) != 2 || physical[0] != "tenant-a%orders" || physical[1] != "tenant-a%payments" {
+		t.Fatalf("unexpected physical topics: %v", physical)
+	}
+
+	// A message shared between concurrent sends is never modified.
+	shared := primitive.NewMessage("orders", []byte("c"))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = client.SendContext(context.Background(), shared)
+			_ = client.sendAsync(context.Background(), "", shared, nil)
+		}()
+	}
+	wg.Wait()
+	if shared.Topic != "orders" {
+		t.Fatalf("expected shared message to keep its logical topic, got %s", shared.Topic)
+	}
+}
+
+func TestObserveProcessingTime(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+
+	var observed []string
+	for i := 0; i < 2; i++ {
+		client.ObserveProcessingTime(func(topic string, d time.Duration) {
+			if d >= 5*time.Millisecond {
+				observed = append(observed, topic)
+			}
+		})
+	}
+
+	cb := client.newConsumeCallback(state, func(context.Context, *primitive.MessageExt) error {
+		time.Sleep(5 * time.Millisecond)
+		return errors.New("failed")
+	})
+	_, _ = cb(context.Background(), &primitive.MessageExt{Message: primitive.Message{Topic: "order-events"}, MsgId: "m-1"})
+
+	if len(observed) != 2 || observed[0] != "order-events" {
+		t.Fatalf("expected both observers to see the failed invocation, got %v", observed)
+	}
+}
+
+func TestRetryJitterAdjustsDelayLevel(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	state.apply(WithRetryJitter(time.Minute))
+
+	cb := client.newConsumeCallback(state, func(context.Context, *primitive.MessageExt) error {
+		return errors.New("database unavailable")
+	})
+
+	// The default first retry is level 3 (10s); with up to a minute of jitter
+	// it lands on a level between 10s (level 3) and 1m (level 5).
+	seen := make(map[int]bool)
+	for i := 0; i < 200; i++ {
+		ctx, concurrentCtx := newConcurrentlyContext()
+		_, _ = cb(ctx, &primitive.MessageExt{MsgId: "m-1"})
+		level := concurrentCtx.DelayLevelWhenNextConsume
+		if level < 3 || level > 5 {
+			t.Fatalf("delay level %d outside the jitter range", level)
+		}
+		seen[level] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("expected jitter to vary the delay level, saw %v", seen)
+	}
+}
+
+func TestRetryJitterSpreadsSmallJitter(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	// A second of jitter is far less than the 20s gap between levels 3 and
+	// 4, yet messages that fail together must not all retry together.
+	state.apply(WithRetryJitter(time.Second))
+	cb := client.newConsumeCallback(state, func(context.Context, *primitive.MessageExt) error {
+		return errors.New("database unavailable")
+	})
+
+	levels := make(map[int]int)
+	for i := 0; i < 100; i++ {
+		ctx, concurrentCtx := newConcurrentlyContext()
+		_, _ = cb(ctx, &primitive.MessageExt{MsgId: "m-" + strconv.Itoa(i)})
+		levels[concurrentCtx.DelayLevelWhenNextConsume]++
+	}
+	if len(levels) != 2 || levels[3] == 0 || levels[4] == 0 {
+		t.Fatalf("expected retries spread over levels 3 and 4, got %v", levels)
+	}
+}
+
+func TestConfigureDefaultProducerBeforeStartup(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	client.ConfigureProducer("", WithTopicNamespace("tenant-a"))
+	client.ConfigureProducer("", WithRateLimit(1000))
+	if _, ok := client.producerStates[""]; ok {
+		t.Fatal("expected no state under the empty name")
+	}
+
+	// The first producer to start becomes the default and takes the options.
+	client.addProducer("p1", &fakeProducer{}, nil)
+	client.addProducer("p2", &fakeProducer{}, nil)
+	if opts := client.producerOptions("p1"); opts.topicNamespace != "tenant-a" || opts.rateLimit != 1000 {
+		t.Fatalf("expected default producer to take the early options, got %+v", opts)
+	}
+	if opts := client.producerOptions("p2"); opts.topicNamespace != "" {
+		t.Fatalf("expected other producers to keep their own options, got %+v", opts)
+	}
+
+	client.ConfigureProducer("", WithRateLimit(10))
+	if got := client.producerOptions("p1").rateLimit; got != 10 {
+		t.Fatalf("expected later options to reach the default producer, got rate limit %v", got)
+	}
+}
+
+func TestProducerTagSelector(t *testing.T) {
+	fp := &fakeProducer{}
+	client := newTestClientWithProducer("p1", fp)
+	client.ConfigureProducer("", WithTagSelector(func(msg *primitive.Message) string {
+		return msg.GetProperty("event_type")
+	}))
+
+	derived := primitive.NewMessage("orders", []byte("a"))
+	derived.WithProperty("event_type", "created")
+	explicit := primitive.NewMessage("orders", []byte("b"))
+	explicit.WithProperty("event_type", "created")
+	explicit.WithTag("manual")
+
+	for _, msg := range []*primitive.Message{derived, explicit} {
+		if _, err := client.SendContext(context.Background(), msg); err != nil {
+			t.Fatalf("SendContext failed: %v", err)
+		}
+	}
+
+	sent := fp.sentMessages()
+	if sent[0].GetTags() != "created" || sent[1].GetTags() != "manual" {
+		t.Fatalf("unexpected tags: %q, %q", sent[0].GetTags(), sent[1].GetTags())
+	}
+}
+
+func TestMessageReceivedAt(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+
+	before := time.Now()
+	var receivedAt time.Time
+	var ok bool
+	cb := client.newConsumeCallback(state, func(ctx context.Context, _ *primitive.MessageExt) error {
+		receivedAt, ok = MessageReceivedAt(ctx)
+		return nil
+	})
+	_, _ = cb(context.Background(), &primitive.MessageExt{MsgId: "m-1"})
+
+	if !ok || receivedAt.Before(before) || receivedAt.After(time.Now()) {
+		t.Fatalf("unexpected receipt time %v (ok=%t)", receivedAt, ok)
+	}
+	if _, ok := MessageReceivedAt(context.Background()); ok {
+		t.Fatal("expected no receipt time outside a consume callback")
+	}
+}
+
+func TestSubscribeLogsInstance(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	fc := &fakePushConsumer{}
+	client.consumers["orders"] = fc
+	handler := func(context.Context, *primitive.MessageExt) error { return nil }
+	subscribe := func() error {
+		return client.SubscribeWith(context.Background(), "orders", []string{"orders"}, handler, WithNamedConsumerInstance("orders-blue"))
+	}
+
+	cases := []struct {
+		line  string
+		setup func()
+	}{
+		{"Subscribed to RocketMQ topics", func() {}},
+		{"Failed to subscribe to RocketMQ topic", func() { fc.subscribeErr = errors.New("no route") }},
+		{"Failed to start RocketMQ consumer", func() { fc.subscribeErr, fc.startErr = nil, errors.New("already started") }},
+	}
+	for _, tc := range cases {
+		tc.setup()
+		logs := captureLogs(t, func() { _ = subscribe() })
+		if !strings.Contains(logs, tc.line+"consumerordersinstanceorders-blue") {
+			t.Fatalf("expected %q with the instance name, got %q", tc.line, logs)
+		}
+	}
+}
+
+func TestNamedInstanceMetricLabels(t *testing.T) {
+	client := newTestClientWithProducer("p1", &fakeProducer{})
+	client.addProducer("p2", &fakeProducer{}, nil)
+	client.ConfigureProducer("p1", WithNamedInstance("orders-blue"))
+	for _, name := range []string{"p1", "p2", "p2"} {
+		if err := client.SendMessageWith(context.Background(), name, "orders", []byte("a")); err != nil {
+			t.Fatalf("SendMessageWith(%s) failed: %v", name, err)
+		}
+	}
+
+	state := client.consumerState("orders")
+	state.apply(WithNamedConsumerInstance("orders-green"))
+	cb := client.newConsumeCallback(state, func(context.Context, *primitive.MessageExt) error { return nil })
+	_, _ = cb(context.Background(), &primitive.MessageExt{MsgId: "m-1"})
+
+	m := client.metrics
+	for _, tc := range []struct {
+		counter  *prometheus.CounterVec
+		instance string
+		want     float64
+	}{
+		{m.promProducerSent, "orders-blue", 1},
+		{m.promProducerSent, "p2", 2},
+		{m.promConsumerReceived, "orders-green", 1},
+	} {
+		if got := promtestutil.ToFloat64(tc.counter.WithLabelValues(tc.instance)); got != tc.want {
+			t.Fatalf("instance %q: got %v, want %v", tc.instance, got, tc.want)
+		}
+	}
+	if got := m.GetStats().ProducerSent; got != 3 {
+		t.Fatalf("expected in-process counter to span instances, got %d", got)
+	}
+}
+
+func TestConsumerTopics(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	client.consumers["orders"] = &fakePushConsumer{}
+	client.defaultConsumer = "orders"
+	handler := func(context.Context, *primitive.MessageExt) error { return nil }
+
+	if err := client.Subscribe(context.Background(), []string{"payments", "orders"}, handler); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := client.SubscribeWith(context.Background(), "orders", []string{"orders", "refunds"}, handler); err != nil {
+		t.Fatalf("SubscribeWith failed: %v", err)
+	}
+
+	if got := client.Topics(""); !slices.Equal(got, []string{"orders", "payments", "refunds"}) {
+		t.Fatalf("unexpected topics: %v", got)
+	}
+}
+
+func TestProducerMaxPendingMessages(t *testing.T) {
+	fp := &fakeProducer{holdAsync: true}
+	client := newTestClientWithProducer("p1", fp)
+	client.ConfigureProducer("", WithMaxPendingMessages(2))
+
+	for i := 0; i < 2; i++ {
+		if err := client.SendMessageAsync(context.Background(), "orders", []byte("a")); err != nil {
+			t.Fatalf("async send %d failed: %v", i, err)
+		}
+	}
+	if got := client.PendingCount(""); got != 2 {
+		t.Fatalf("expected 2 pending messages, got %d", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.SendMessageAsync(ctx, "orders", []byte("b")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the third send to block until the deadline, got %v", err)
+	}
+
+	fp.completeAsync()
+	if got := client.PendingCount(""); got != 0 {
+		t.Fatalf("expected no pending messages after completion, got %d", got)
+	}
+	if err := client.SendMessageAsync(context.Background(), "orders", []byte("c")); err != nil {
+		t.Fatalf("send after slots freed failed: %v", err)
+	}
+}
+
+func TestPanicDumpToStderr(t *testing.T) {
+	var dump strings.Builder
+	orig := panicDumpWriter
+	panicDumpWriter = &dump
+	defer func() { panicDumpWriter = orig }()
+
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	state.apply(WithPanicDumpToStderr(true))
+
+	cb := client.newConsumeCallback(state, func(context.Context, *primitive.MessageExt) error {
+		panic("boom")
+	})
+	if result, _ := cb(context.Background(), &primitive.MessageExt{MsgId: "m-1"}); result != consumer.ConsumeRetryLater {
+		t.Fatalf("expected ConsumeRetryLater after panic, got %v", result)
+	}
+
+	out := dump.String()
+	if !strings.Contains(out, "msgId=m-1): boom") || !strings.Contains(out, "goroutine ") {
+		t.Fatalf("expected panic message and stack trace, got %q", out)
+	}
+}
+
+func TestSendRetryReusesMessageIDAfterLostAck(t *testing.T) {
+	var attemptIDs []string
+	fp := &fakeProducer{sendSync: func(_ context.Context, msg *primitive.Message) (*primitive.SendResult, error) {
+		// Assign the ID as the SDK's buildSendRequest does.
+		if msg.GetProperty(primitive.PropertyUniqueClientMessageIdKeyIndex) == "" {
+			msg.WithProperty(primitive.PropertyUniqueClientMessageIdKeyIndex, primitive.CreateUniqID())
+		}
+		id := msg.GetProperty(primitive.PropertyUniqueClientMessageIdKeyIndex)
+		attemptIDs = append(attemptIDs, id)
+		if len(attemptIDs) == 1 {
+			// The broker stored the message but the response never arrived.
+			return nil, fmt.Errorf("send to broker: %w", context.DeadlineExceeded)
+		}
+		return &primitive.SendResult{Status: primitive.SendOK, MsgID: id}, nil
+	}}
+	client := newTestClientWithProducer("p1", fp)
+
+	result, err := client.SendMessageSync(context.Background(), "orders", []byte("a"))
+	if err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	if len(attemptIDs) != 2 || attemptIDs[0] == "" || attemptIDs[0] != attemptIDs[1] {
+		t.Fatalf("expected both attempts to carry the same message ID, got %v", attemptIDs)
+	}
+	if result.MsgID != attemptIDs[0] {
+		t.Fatalf("expected result to report the first attempt's ID %s, got %s", attemptIDs[0], result.MsgID)
+	}
+}
+
+func TestGracefulStopWaitsForAsyncCallbacks(t *testing.T) {
+	fp := &fakeProducer{holdAsync: true}
+	client := newTestClientWithProducer("p1", fp)
+
+	if err := client.SendMessageAsync(context.Background(), "orders", []byte("a")); err != nil {
+		t.Fatalf("async send failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	var pending *ErrShutdownPending
+	if err := client.GracefulStop(ctx); !errors.As(err, &pending) || pending.Count != 1 {
+		t.Fatalf("expected ErrShutdownPending with 1 callback, got %v", err)
+	}
+	if err := client.SendMessageAsync(context.Background(), "orders", []byte("b")); !errors.Is(err, ErrProducerNotReady) {
+		t.Fatalf("expected new async sends to be rejected while draining, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- client.GracefulStop(context.Background()) }()
+	fp.completeAsync()
+	if err := <-done; err != nil {
+		t.Fatalf("GracefulStop failed: %v", err)
+	}
+	if got := client.PendingCallbackCount(); got != 0 {
+		t.Fatalf("expected no pending callbacks after stop, got %d", got)
+	}
+	if _, err := client.GetProducer("p1"); err == nil {
+		t.Fatal("expected producers to be shut down")
+	}
+}
+
+func TestGracefulStopDrainsSyncAndAsyncSends(t *testing.T) {
+	release := make(chan struct{})
+	fp := &fakeProducer{holdAsync: true}
+	fp.sendSync = func(_ context.Context, msg *primitive.Message) (*primitive.SendResult, error) {
+		if string(msg.Body) == "slow" {
+			<-release
+		}
+		return &primitive.SendResult{Status: primitive.SendOK}, nil
+	}
+	client := newTestClientWithProducer("p1", fp)
+
+	syncDone := make(chan error, 1)
+	go func() {
+		_, err := client.SendMessageSync(context.Background(), "orders", []byte("slow"))
+		syncDone <- err
+	}()
+	if err := client.SendMessageAsync(context.Background(), "orders", []byte("a")); err != nil {
+		t.Fatalf("async send failed: %v", err)
+	}
+	waitForCondition(t, time.Second, time.Millisecond, func() bool { return atomic.LoadInt64(&client.inFlight) == 2 })
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- client.GracefulStop(context.Background()) }()
+	waitForCondition(t, time.Second, time.Millisecond, func() bool { return atomic.LoadInt32(&client.draining) == 1 })
+
+	if _, err := client.SendMessageSync(context.Background(), "orders", []byte("b")); !errors.Is(err, ErrProducerNotReady) {
+		t.Fatalf("expected new sync sends to be rejected while draining, got %v", err)
+	}
+	if err := client.SendMessageAsync(context.Background(), "orders", []byte("c")); !errors.Is(err, ErrProducerNotReady) {
+		t.Fatalf("expected new async sends to be rejected while draining, got %v", err)
+	}
+
+	close(release)
+	if err := <-syncDone; err != nil {
+		t.Fatalf("in-flight sync send failed: %v", err)
+	}
+	select {
+	case err := <-stopped:
+		t.Fatalf("GracefulStop returned with an async callback outstanding: %v", err)
+	case <-time.After(30 * time.Millisecond):
+	}
+	fp.completeAsync()
+	if err := <-stopped; err != nil {
+		t.Fatalf("GracefulStop failed: %v", err)
+	}
+}
+
+func TestGracefulStopConcurrentSends(t *testing.T) {
+	fp := &fakeProducer{}
+	var afterShutdown atomic.Int64
+	fp.sendSync = func(context.Context, *primitive.Message) (*primitive.SendResult, error) {
+		if fp.shutdown.Load() {
+			afterShutdown.Add(1)
+		}
+		time.Sleep(100 * time.Microsecond)
+		return &primitive.SendResult{Status: primitive.SendOK}, nil
+	}
+	client := newTestClientWithProducer("p1", fp)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(async bool) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				var err error
+				if async {
+					err = client.SendMessageAsync(context.Background(), "orders", []byte("a"))
+				} else {
+					_, err = client.SendMessageSync(context.Background(), "orders", []byte("a"))
+				}
+				// Rejected while draining, or after shutdown removed the producer.
+				if err != nil && !errors.Is(err, ErrProducerNotReady) && !errors.Is(err, ErrProducerNotFound) {
+					t.Errorf("unexpected send error: %v", err)
+					return
+				}
+			}
+		}(i%2 == 0)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := client.GracefulStop(context.Background()); err != nil {
+		t.Fatalf("GracefulStop failed: %v", err)
+	}
+	close(stop)
+	wg.Wait()
+
+	if n := afterShutdown.Load(); n != 0 {
+		t.Fatalf("expected no sends to reach the shut down producer, got %d", n)
+	}
+}
+
+func TestConsumerMaxRetriesRoutesToDLQ(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	if got := client.MaxRetries("orders"); got != defaultConsumerMaxRetries {
+		t.Fatalf("expected default max retries %d, got %d", defaultConsumerMaxRetries, got)
+	}
+
+	state.apply(WithMaxRetries(2))
+	cb := client.newConsumeCallback(state, func(context.Context, *primitive.MessageExt) error {
+		return errors.New("validation failed")
+	})
+
+	for _, tc := range []struct {
+		reconsumeTimes int32
+		wantDelay      int
+	}{
+		{reconsumeTimes: 1, wantDelay: 0},
+		{reconsumeTimes: 2, wantDelay: -1},
+		{reconsumeTimes: 3, wantDelay: -1},
+	} {
+		ctx, concurrentCtx := newConcurrentlyContext()
+		if result, _ := cb(ctx, &primitive.MessageExt{MsgId: "m-1", ReconsumeTimes: tc.reconsumeTimes}); result != consumer.ConsumeRetryLater {
+			t.Fatalf("reconsumeTimes=%d: expected ConsumeRetryLater, got %v", tc.reconsumeTimes, result)
+		}
+		if concurrentCtx.DelayLevelWhenNextConsume != tc.wantDelay {
+			t.Fatalf("reconsumeTimes=%d: delay level = %d, want %d", tc.reconsumeTimes, concurrentCtx.DelayLevelWhenNextConsume, tc.wantDelay)
+		}
+	}
+
+	if got := client.MaxRetries("orders"); got != 2 {
+		t.Fatalf("expected max retries 2, got %d", got)
+	}
+	if got := client.RetryExhaustedCount("orders"); got != 2 {
+		t.Fatalf("expected 2 exhausted messages, got %d", got)
+	}
+
+	// The SDK's own limit of 16 is never raised, so larger values are rejected.
+	client.consumers["orders"] = &fakePushConsumer{}
+	handler := func(context.Context, *primitive.MessageExt) error { return nil }
+	err := client.SubscribeWith(context.Background(), "orders", []string{"orders"}, handler, WithMaxRetries(defaultConsumerMaxRetries+1))
+	if !errors.Is(err, ErrInvalidConfiguration) {
+		t.Fatalf("expected ErrInvalidConfiguration above the SDK limit, got %v", err)
+	}
+	if got := client.MaxRetries("orders"); got != 2 {
+		t.Fatalf("expected rejected options to leave max retries at 2, got %d", got)
+	}
+}
+
+func TestConsumerLogEveryRate(t *testing.T) {
+	state := newConsumerState("orders")
+	start := time.Now()
+
+	var lines []float64
+	for i := 0; i < 6; i++ {
+		// Two messages per second on average: one every 500ms.
+		at := start.Add(time.Duration(i) * 500 * time.Millisecond)
+		if count, rate, due := state.recordProcessed("orders", 3, at); due {
+			if count != int64(i+1) {
+				t.Fatalf("expected count %d at log line, got %d", i+1, count)
+			}
+			lines = append(lines, rate)
+		}
+	}
+
+	// The first line covers messages 1-3 (1s), the second messages 4-6 (1.5s).
+	if len(lines) != 2 || lines[0] != 3 || lines[1] != 2 {
+		t.Fatalf("unexpected log line rates: %v", lines)
+	}
+	if _, _, due := state.recordProcessed("payments", 3, start); due {
+		t.Fatal("expected topics to be counted separately")
+	}
+}
+
+func TestConsumeRetryAfterSetsDelayLevel(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	state.apply(WithRetryJitter(time.Hour), WithMaxRetries(3))
+	cb := client.newConsumeCallback(state, func(context.Context, *primitive.MessageExt) error {
+		return fmt.Errorf("inventory service: 429 too many requests: %w", ConsumeRetryAfter(2*time.Minute))
+	})
+
+	for _, tc := range []struct {
+		reconsumeTimes int32
+		wantDelay      int
+	}{
+		// Level 6 is 2m, overriding the jitter.
+		{reconsumeTimes: 0, wantDelay: 6},
+		// Exhausted retries still go to the DLQ.
+		{reconsumeTimes: 3, wantDelay: -1},
+	} {
+		ctx, concurrentCtx := newConcurrentlyContext()
+		result, err := cb(ctx, &primitive.MessageExt{MsgId: "m-1", ReconsumeTimes: tc.reconsumeTimes})
+		var retryAfter *RetryAfterError
+		if result != consumer.ConsumeRetryLater || !errors.As(err, &retryAfter) {
+			t.Fatalf("reconsumeTimes=%d: expected ConsumeRetryLater with RetryAfterError, got %v, %v", tc.reconsumeTimes, result, err)
+		}
+		if concurrentCtx.DelayLevelWhenNextConsume != tc.wantDelay {
+			t.Fatalf("reconsumeTimes=%d: delay level = %d, want %d", tc.reconsumeTimes, concurrentCtx.DelayLevelWhenNextConsume, tc.wantDelay)
+		}
+	}
+}
+
+func TestLoadShedderDropsLowestPriority(t *testing.T) {
+	fp := &fakeProducer{holdAsync: true}
+	client := newTestClientWithProducer("p1", fp)
+	priority := func(msg *primitive.Message) int {
+		p, _ := strconv.Atoi(msg.GetProperty("priority"))
+		return p
+	}
+	shedder := NewLoadShedder(client, "", WithShedThreshold(4), WithLoadShedding(DropLowest(priority, 0.5)))
+	newMsg := func(p int) *primitive.Message {
+		msg := primitive.NewMessage("orders", []byte("a"))
+		msg.WithProperty("priority", strconv.Itoa(p))
+		return msg
+	}
+
+	// Below the threshold everything is sent, and the policy learns the mix.
+	for _, p := range []int{1, 2, 3, 4} {
+		if err := shedder.SendAsync(context.Background(), newMsg(p), nil); err != nil {
+			t.Fatalf("send below threshold failed: %v", err)
+		}
+	}
+
+	if err := shedder.SendAsync(context.Background(), newMsg(1), nil); !errors.Is(err, ErrShedded) {
+		t.Fatalf("expected low-priority message to be shed, got %v", err)
+	}
+	if err := shedder.SendAsync(context.Background(), newMsg(4), nil); err != nil {
+		t.Fatalf("expected high-priority message to be sent, got %v", err)
+	}
+	if got := client.metrics.GetStats().LoadShedCount; got != 1 {
+		t.Fatalf("expected 1 shed message, got %d", got)
+	}
+
+	fp.completeAsync()
+	if err := shedder.SendAsync(context.Background(), newMsg(1), nil); err != nil {
+		t.Fatalf("expected sends to resume once load drops, got %v", err)
+	}
+
+	// Uniform priority under overload still loses about dropFraction of its
+	// traffic, with or without a priority function.
+	for _, fn := range []func(*primitive.Message) int{nil, priority} {
+		for _, fraction := range []float64{0.1, 0.3, 0.6} {
+			policy := DropLowest(fn, fraction)
+			const total = 4000
+			shed := 0
+			for i := 0; i < total; i++ {
+				if !policy.Admit(newMsg(2), true) {
+					shed++
+				}
+			}
+			if got := float64(shed) / total; got < fraction-0.05 || got > fraction+0.05 {
+				t.Fatalf("dropFraction %v shed %.3f of uniform traffic", fraction, got)
+			}
+		}
+	}
+}
+
+func TestConsumerMessageRateWindow(t *testing.T) {
+	var w rateWindow
+	now := time.Unix(1_000_000, 0)
+	// 10 messages 20s ago, then 3 per second for the last 5 seconds.
+	for i := 0; i < 10; i++ {
+		w.add(now.Add(-20 * time.Second))
+	}
+	for s := 0; s < 5; s++ {
+		for i := 0; i < 3; i++ {
+			w.add(now.Add(-time.Duration(s) * time.Second))
+		}
+	}
+
+	if got := w.perSecond(now, 5*time.Second); got != 3 {
+		t.Fatalf("5s rate = %v, want 3", got)
+	}
+	if got := w.perSecond(now, 25*time.Second); got != 1 {
+		t.Fatalf("25s rate = %v, want 1", got)
+	}
+	// Buckets older than the ring are overwritten, not counted.
+	if got := w.perSecond(now.Add(maxRateWindow), maxRateWindow); got != 0 {
+		t.Fatalf("rate after the window passed = %v, want 0", got)
+	}
+
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	cb := client.newConsumeCallback(client.consumerState("orders"), func(context.Context, *primitive.MessageExt) error { return nil })
+	for i := 0; i < 4; i++ {
+		if _, err := cb(context.Background(), &primitive.MessageExt{MsgId: "m"}); err != nil {
+			t.Fatalf("consume failed: %v", err)
+		}
+	}
+	if got := client.MessageRateWindow("orders", 2*time.Second); got != 2 {
+		t.Fatalf("expected 2 msg/s over 2s after 4 messages, got %v", got)
+	}
+}
+
+func TestSendBatchStream(t *testing.T) {
+	fp := &fakeProducer{sendSync: func(_ context.Context, msg *primitive.Message) (*primitive.SendResult, error) {
+		if string(msg.Body) == "bad" {
+			return nil, errors.New("message too large")
+		}
+		return &primitive.SendResult{Status: primitive.SendOK, MsgID: string(msg.Body)}, nil
+	}}
+	client := newTestClientWithProducer("p1", fp)
+
+	batches := make(chan []*primitive.Message, 2)
+	batches <- []*primitive.Message{primitive.NewMessage("orders", []byte("a")), primitive.NewMessage("orders", []byte("b"))}
+	batches <- []*primitive.Message{primitive.NewMessage("orders", []byte("c")), primitive.NewMessage("orders", []byte("bad")), primitive.NewMessage("orders", []byte("d"))}
+	close(batches)
+
+	var got []BatchSendResult
+	for result := range client.SendBatchStream(context.Background(), batches) {
+		got = append(got, result)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 batch results, got %d", len(got))
+	}
+	if got[0].Err != nil || len(got[0].Results) != 2 || got[0].Results[1].MsgID != "b" {
+		t.Fatalf("unexpected first batch result: %+v", got[0])
+	}
+	if got[1].Err == nil || len(got[1].Results) != 1 || got[1].Results[0].MsgID != "c" {
+		t.Fatalf("expected second batch to stop at the failing message, got %+v", got[1])
+	}
+}
+
+func TestSendBatchStreamBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	fp := &fakeProducer{sendSync: func(ctx context.Context, _ *primitive.Message) (*primitive.SendResult, error) {
+		<-release
+		return &primitive.SendResult{Status: primitive.SendOK}, nil
+	}}
+	client := newTestClientWithProducer("p1", fp)
+	client.ConfigureProducer("", WithStreamBufferSize(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batches := make(chan []*primitive.Message)
+	results := client.SendBatchStream(ctx, batches)
+	batch := []*primitive.Message{primitive.NewMessage("orders", []byte("a"))}
+
+	// One batch in flight, one buffered, one held by the reader.
+	for i := 0; i < 3; i++ {
+		batches <- batch
+	}
+	select {
+	case batches <- batch:
+		t.Fatal("expected the stream to stop reading once its buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if result := <-results; result.Err != nil {
+		t.Fatalf("unexpected error: %v", result.Err)
+	}
+}
+
+func TestSendBatchStreamStopsOnCancel(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	fp := &fakeProducer{sendSync: func(ctx context.Context, _ *primitive.Message) (*primitive.SendResult, error) {
+		started <- struct{}{}
+		<-release
+		return &primitive.SendResult{Status: primitive.SendOK}, nil
+	}}
+	client := newTestClientWithProducer("p1", fp)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	batches := make(chan []*primitive.Message, 4)
+	for i := 0; i < 4; i++ {
+		batches <- []*primitive.Message{primitive.NewMessage("orders", []byte("a")), primitive.NewMessage("orders", []byte("b"))}
+	}
+	results := client.SendBatchStream(ctx, batches)
+
+	<-started
+	cancel()
+	close(release)
+	for range results {
+	}
+
+	if sent := len(fp.sentMessages()); sent != 1 {
+		t.Fatalf("expected sending to stop after the in-flight message, got %d sends", sent)
+	}
+	if failed := client.metrics.GetStats().ProducerFailed; failed != 0 {
+		t.Fatalf("expected no failures counted for abandoned batches, got %d", failed)
+	}
+}
+
+func TestSendWithHeadersConflictStrategies(t *testing.T) {
+	fp := &fakeProducer{}
+	client := newTestClientWithProducer("p1", fp)
+	headers := map[string]string{"tenant": "acme", PropertyCorrelationID: "req-2"}
+	newMsg := func() *primitive.Message {
+		msg := primitive.NewMessage("orders", []byte("a"))
+		msg.WithProperty(PropertyCorrelationID, "req-1")
+		return msg
+	}
+
+	msg := newMsg()
+	if _, err := client.SendWithHeaders(context.Background(), msg, headers); !errors.Is(err, ErrHeaderConflict) {
+		t.Fatalf("expected ErrHeaderConflict by default, got %v", err)
+	}
+	if msg.GetProperty("tenant") != "" || len(fp.sentMessages()) != 0 {
+		t.Fatal("expected a conflicting send to leave the message untouched and unsent")
+	}
+
+	for _, tc := range []struct {
+		strategy HeaderConflictStrategy
+		want     string
+	}{
+		{PreferHeader, "req-2"},
+		{PreferMessage, "req-1"},
+	} {
+		client.ConfigureProducer("", WithHeaderConflictStrategy(tc.strategy))
+		msg := newMsg()
+		if _, err := client.SendWithHeaders(context.Background(), msg, headers); err != nil {
+			t.Fatalf("strategy %d: send failed: %v", tc.strategy, err)
+		}
+		if got := msg.GetProperty(PropertyCorrelationID); got != tc.want || msg.GetProperty("tenant") != "acme" {
+			t.Fatalf("strategy %d: correlation ID %q, tenant %q", tc.strategy, got, msg.GetProperty("tenant"))
+		}
+	}
+}
+
+func TestConsumerTopicMismatch(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	state.addTopic("orders")
+	state.addTopic("refunds")
+	var handled int
+	cb := client.newConsumeCallback(state, func(context.Context, *primitive.MessageExt) error {
+		handled++
+		return nil
+	})
+
+	result, err := cb(context.Background(), &primitive.MessageExt{Message: primitive.Message{Topic: "payments"}, MsgId: "m-1"})
+	var mismatch *ErrTopicMismatch
+	if result != consumer.ConsumeRetryLater || !errors.As(err, &mismatch) {
+		t.Fatalf("expected ConsumeRetryLater with ErrTopicMismatch, got %v, %v", result, err)
+	}
+	if mismatch.Got != "payments" || mismatch.Expected != "orders,refunds" {
+		t.Fatalf("unexpected mismatch: %+v", mismatch)
+	}
+	if handled != 0 || client.metrics.GetStats().TopicMismatchCount != 1 {
+		t.Fatalf("expected the handler to be skipped and the mismatch counted, handled %d", handled)
+	}
+
+	if result, err := cb(context.Background(), &primitive.MessageExt{Message: primitive.Message{Topic: "refunds"}, MsgId: "m-2"}); result != consumer.ConsumeSuccess || err != nil {
+		t.Fatalf("expected subscribed topic to be consumed, got %v, %v", result, err)
+	}
+}
+
+func TestConsumerDecoderFallbackChain(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	var decodeErrs []string
+	state.apply(
+		WithDecoderFallbackChain(
+			func(body []byte) ([]byte, error) {
+				if !json.Valid(body) {
+					return nil, errors.New("not JSON")
+				}
+				return body, nil
+			},
+			// Legacy messages carry the bare order ID.
+			func(body []byte) ([]byte, error) {
+				if len(body) == 0 || body[0] == '{' {
+					return nil, errors.New("not a legacy message")
+				}
+				return json.Marshal(map[string]string{"id": string(body)})
+			},
+		),
+		WithDeserializationErrorHandler(func(_ context.Context, raw *primitive.MessageExt, _ error) {
+			decodeErrs = append(decodeErrs, raw.MsgId)
+		}),
+	)
+	var handled []string
+	cb := client.newConsumeCallback(state, func(_ context.Context, msg *primitive.MessageExt) error {
+		handled = append(handled, string(msg.Body))
+		return nil
+	})
+
+	legacy := &primitive.MessageExt{Message: primitive.Message{Topic: "orders", Body: []byte("o-2")}, MsgId: "m-2"}
+	for _, msg := range []*primitive.MessageExt{
+		{Message: primitive.Message{Topic: "orders", Body: []byte(`{"id":"o-1"}`)}, MsgId: "m-1"},
+		legacy,
+	} {
+		if result, err := cb(context.Background(), msg); err != nil || result != consumer.ConsumeSuccess {
+			t.Fatalf("consume %s: result %v, error %v", msg.MsgId, result, err)
+		}
+	}
+	if want := []string{`{"id":"o-1"}`, `{"id":"o-2"}`}; !slices.Equal(handled, want) {
+		t.Fatalf("handled %v, want %v", handled, want)
+	}
+	if string(legacy.Body) != "o-2" {
+		t.Fatalf("raw message body was modified: %q", legacy.Body)
+	}
+
+	ctx, concurrentCtx := newConcurrentlyContext()
+	_, err := cb(ctx, &primitive.MessageExt{Message: primitive.Message{Topic: "orders", Body: []byte(`{"id":`)}, MsgId: "m-3"})
+	if !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrInvalidMessage when every decoder fails, got %v", err)
+	}
+	if !slices.Equal(decodeErrs, []string{"m-3"}) || concurrentCtx.DelayLevelWhenNextConsume != -1 || len(handled) != 2 {
+		t.Fatalf("expected error handler call and DLQ routing without handling, got %v, delay level %d, handled %v",
+			decodeErrs, concurrentCtx.DelayLevelWhenNextConsume, handled)
+	}
+}
+
+func TestConsumerFingerprintDedup(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	state.apply(WithFingerprintDedup(2))
+	var handled []string
+	failNext := false
+	cb := client.newConsumeCallback(state, func(_ context.Context, msg *primitive.MessageExt) error {
+		if failNext {
+			failNext = false
+			return errors.New("boom")
+		}
+		handled = append(handled, msg.MsgId)
+		return nil
+	})
+	deliver := func(msgID, body string) {
+		_, _ = cb(context.Background(), &primitive.MessageExt{Message: primitive.Message{Topic: "orders", Body: []byte(body)}, MsgId: msgID})
+	}
+
+	deliver("m-1", "a")
+	deliver("m-2", "a") // duplicate of m-1
+	failNext = true
+	deliver("m-3", "b") // fails, so its fingerprint is not recorded
+	deliver("m-4", "b")
+	deliver("m-5", "c") // evicts "a"
+	deliver("m-6", "a")
+
+	if want := []string{"m-1", "m-4", "m-5", "m-6"}; !slices.Equal(handled, want) {
+		t.Fatalf("handled %v, want %v", handled, want)
+	}
+	stats := client.metrics.GetStats()
+	if stats.FingerprintCacheHitCount != 1 || stats.FingerprintCacheMissCount != 5 {
+		t.Fatalf("expected 1 hit and 5 misses, got %d and %d", stats.FingerprintCacheHitCount, stats.FingerprintCacheMissCount)
+	}
+}
+
+func TestTopicMetrics(t *testing.T) {
+	var calls int
+	fp := &fakeProducer{sendSync: func(_ context.Context, msg *primitive.Message) (*primitive.SendResult, error) {
+		calls++
+		if string(msg.Body) == "bad" || calls == 1 {
+			return nil, errors.New("broker busy")
+		}
+		return &primitive.SendResult{Status: primitive.SendOK, MsgID: "m"}, nil
+	}}
+	client := newTestClientWithProducer("default", fp)
+	ctx := context.Background()
+
+	if got := client.TopicMetrics("orders"); got != (TopicMetrics{}) {
+		t.Fatalf("expected zero metrics before the first send, got %+v", got)
+	}
+
+	// First attempt fails, the retry succeeds.
+	if _, err := client.SendContext(ctx, primitive.NewMessage("orders", []byte("hello"))); err != nil {
+		t.Fatalf("SendContext failed: %v", err)
+	}
+	// Fails on every attempt.
+	if _, err := client.SendContext(ctx, primitive.NewMessage("orders", []byte("bad"))); err == nil {
+		t.Fatal("expected send to fail")
+	}
+
+	fp.holdAsync = true
+	if err := client.SendMessageAsync(ctx, "orders", []byte("async")); err != nil {
+		t.Fatalf("SendMessageAsync failed: %v", err)
+	}
+	if got := client.TopicMetrics("orders").CurrentQueueCount; got != 1 {
+		t.Fatalf("expected 1 queued async send, got %d", got)
+	}
+	fp.completeAsync()
+
+	got := client.TopicMetrics("orders")
+	if got.TotalSent != 2 || got.TotalErrors != 1 || got.TotalRetries != 3 || got.TotalBytesProduced != 10 || got.CurrentQueueCount != 0 {
+		t.Fatalf("unexpected topic metrics: %+v", got)
+	}
+	if got.AverageSendLatency <= 0 {
+		t.Fatalf("expected a positive average latency, got %v", got.AverageSendLatency)
+	}
+	if other := client.TopicMetricsWith("default", "refunds"); other != (TopicMetrics{}) {
+		t.Fatalf("expected no metrics for an unused topic, got %+v", other)
+	}
+}
+
+func TestStateAccessorsDoNotCreateEntries(t *testing.T) {
+	client := newTestClientWithProducer("p1", &fakeProducer{})
+
+	if topics := client.Topics("ordrs"); topics != nil {
+		t.Fatalf("expected no topics for an unknown consumer, got %v", topics)
+	}
+	if client.MaxRetries("ordrs") != 0 || client.RetryExhaustedCount("ordrs") != 0 || client.MessageRateWindow("ordrs", time.Second) != 0 {
+		t.Fatal("expected zero values for an unknown consumer")
+	}
+	if client.PendingCount("p2") != 0 || client.TopicMetricsWith("p2", "orders") != (TopicMetrics{}) {
+		t.Fatal("expected zero values for an unknown producer")
+	}
+
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	if len(client.consumerStates) != 0 || len(client.producerStates) != 1 {
+		t.Fatalf("expected read-only accessors to leave no state behind, got %d consumer and %d producer states",
+			len(client.consumerStates), len(client.producerStates))
+	}
+}
+
+func TestAckLoggingEntries(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	state.apply(WithAckLogging(true))
+
+	var fail atomic.Bool
+	cb := client.newConsumeCallback(state, func(context.Context, *primitive.MessageExt) error {
+		if fail.Load() {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	msg := &primitive.MessageExt{MsgId: "m-1", ReconsumeTimes: 1}
+	msg.Topic = "orders"
+	msg.WithProperty(PropertyCorrelationID, "corr-1")
+
+	fail.Store(true)
+	nack := captureLogs(t, func() { _, _ = cb(context.Background(), msg) })
+	fail.Store(false)
+	ack := captureLogs(t, func() { _, _ = cb(context.Background(), msg) })
+
+	for action, logs := range map[string]string{"nack": nack, "ack": ack} {
+		if !strings.Contains(logs, "RocketMQ message "+action+"consumerorders") {
+			t.Fatalf("expected a %s entry, got %q", action, logs)
+		}
+		if !strings.Contains(logs, "correlationIdcorr-1") || !strings.Contains(logs, "attempt2") {
+			t.Fatalf("expected %s entry to carry correlationId and attempt, got %q", action, logs)
+		}
+	}
+	if strings.Contains(nack, "RocketMQ message ackconsumer") || strings.Contains(ack, "RocketMQ message nackconsumer") {
+		t.Fatalf("ack and nack entries mixed up: nack %q, ack %q", nack, ack)
+	}
+
+	records := client.Last100Errors("orders")
+	if len(records) != 2 || records[0].Result != consumer.ConsumeRetryLater || records[0].Err == nil || records[1].Result != consumer.ConsumeSuccess {
+		t.Fatalf("expected the nack then the ack in Last100Errors, got %+v", records)
+	}
+	for _, rec := range records {
+		if rec.MsgID != "m-1" || rec.CorrelationID != "corr-1" || rec.Attempt != 2 || rec.Topic != "orders" {
+			t.Fatalf("unexpected record %+v", rec)
+		}
+	}
+}
+
+func TestLast100ErrorsKeepsRecentNacks(t *testing.T) {
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	cb := client.newConsumeCallback(state, func(_ context.Context, m *primitive.MessageExt) error {
+		if m.MsgId == "ok" {
+			return nil
+		}
+		return errors.New("boom")
+	})
+
+	// Without WithAckLogging only nacks are kept, and only the last 100.
+	_, _ = cb(context.Background(), &primitive.MessageExt{MsgId: "ok"})
+	for i := 0; i < 150; i++ {
+		_, _ = cb(context.Background(), &primitive.MessageExt{MsgId: "m-" + strconv.Itoa(i)})
+	}
+	records := client.Last100Errors("orders")
+	if len(records) != 100 || records[0].MsgID != "m-50" || records[99].MsgID != "m-149" {
+		t.Fatalf("expected nacks m-50..m-149, got %d records", len(records))
+	}
+	if client.Last100Errors("unknown") != nil {
+		t.Fatal("expected nil for an unknown consumer")
+	}
+}
+
+func TestTracingTaskPerMessage(t *testing.T) {
+	if testing.Short() {
+		t.Skip("decodes the trace with go tool trace")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not available")
+	}
+	if rtrace.IsEnabled() {
+		t.Skip("runtime trace already running")
+	}
+
+	client := NewRocketMQClient()
+	client.metrics = newIsolatedMetrics()
+	state := client.consumerState("orders")
+	state.apply(WithTracing(true))
+	cb := client.newConsumeCallback(state, func(ctx context.Context, m *primitive.MessageExt) error {
+		rtrace.Log(ctx, "handler", m.MsgId)
+		return nil
+	})
+	msgs := []*primitive.MessageExt{{MsgId: "m-1"}, {MsgId: "m-2"}}
+	for _, m := range msgs {
+		m.Topic = "orders"
+	}
+
+	path := filepath.Join(t.TempDir(), "consume.trace")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create trace file: %v", err)
+	}
+	if err := rtrace.Start(f); err != nil {
+		t.Fatalf("trace.Start failed: %v", err)
+	}
+	_, _ = cb(context.Background(), msgs...)
+	rtrace.Stop()
+	_ = f.Close()
+
+	out, err := exec.Command(goTool, "tool", "trace", "-d=parsed", path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go tool trace failed: %v\n%s", err, out)
+	}
+
+	// Expect, in order: each message's task begins, the handler logs inside
+	// it, and the task ends before the next message's task begins.
+	var events []string
+	for _, line := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.Contains(line, " TaskBegin ") && strings.Contains(line, `Type="rocketmq:message:orders"`):
+			events = append(events, "begin")
+		case strings.Contains(line, " TaskEnd ") && strings.Contains(line, `Type="rocketmq:message:orders"`):
+			events = append(events, "end")
+		case strings.Contains(line, `Category="handler"`) && !strings.Contains(line, "Task=0 "):
+			events = append(events, "handler")
+		}
+	}
+	want := []string{"begin", "handler", "end", "begin", "handler", "end"}
+	if !slices.Equal(events, want) {
+		t.Fatalf("unexpected task events %v, want %v", events, want)
+	}
+}
@@ -0,0 +1,351 @@
+package rocketmq
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+// consumerState is the runtime state the plugin keeps per consumer instance:
+// its options and the messages awaiting a manual ack.
+type consumerState struct {
+	name string
+
+	mu          sync.RWMutex
+	opts        consumerOptions
+	pendingAcks map[*primitive.MessageExt]chan consumer.ConsumeResult
+	topics      map[string]struct{}
+
+	// retryExhausted counts messages routed to the DLQ after maxRetries
+	retryExhausted int64
+
+	// Per-topic processed message counts for WithLogEvery
+	progress map[string]*topicProgress
+
+	// Processed messages per second, for MessageRateWindow
+	rate rateWindow
+
+	// Fingerprints of recently processed messages, for WithFingerprintDedup
+	fingerprints fingerprintSet
+
+	// Recent ack decisions, for Last100Errors
+	recentAcks ackRing
+}
+
+// AckRecord is an ack decision kept by Last100Errors.
+type AckRecord struct {
+	At            time.Time
+	Topic         string
+	MsgID         string
+	CorrelationID string
+	Result        consumer.ConsumeResult
+	// Attempt is the delivery attempt, starting at 1.
+	Attempt int32
+	// Err is the reason for a nack, if any.
+	Err error
+}
+
+// recentAckLimit is how many ack decisions Last100Errors keeps per consumer.
+const recentAckLimit = 100
+
+// ackRing holds the most recent recentAckLimit ack decisions.
+type ackRing struct {
+	mu      sync.Mutex
+	records []AckRecord
+	next    int
+}
+
+// add appends rec, overwriting the oldest record once full.
+func (a *ackRing) add(rec AckRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.records) < recentAckLimit {
+		a.records = append(a.records, rec)
+		return
+	}
+	a.records[a.next] = rec
+	a.next = (a.next + 1) % recentAckLimit
+}
+
+// snapshot returns the records, oldest first.
+func (a *ackRing) snapshot() []AckRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]AckRecord, 0, len(a.records))
+	out = append(out, a.records[a.next:]...)
+	return append(out, a.records[:a.next]...)
+}
+
+// fingerprintSet holds the most recently added message fingerprints, evicting
+// the oldest once full.
+type fingerprintSet struct {
+	mu    sync.Mutex
+	seen  map[uint64]struct{}
+	order []uint64
+	next  int
+}
+
+// contains reports whether fp is in the set.
+func (f *fingerprintSet) contains(fp uint64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.seen[fp]
+	return ok
+}
+
+// add inserts fp, keeping at most size fingerprints.
+func (f *fingerprintSet) add(fp uint64, size int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.seen == nil {
+		f.seen = make(map[uint64]struct{}, size)
+	}
+	if _, ok := f.seen[fp]; ok {
+		return
+	}
+	f.seen[fp] = struct{}{}
+	if len(f.order) < size {
+		f.order = append(f.order, fp)
+		return
+	}
+	delete(f.seen, f.order[f.next])
+	f.order[f.next] = fp
+	f.next = (f.next + 1) % len(f.order)
+}
+
+// maxRateWindow is the longest window MessageRateWindow can average over.
+const maxRateWindow = 300 * time.Second
+
+// rateWindow counts events in per-second buckets over the last maxRateWindow,
+// in a ring indexed by Unix second.
+type rateWindow struct {
+	mu      sync.Mutex
+	counts  [maxRateWindow / time.Second]int64
+	seconds [maxRateWindow / time.Second]int64
+}
+
+// add counts one event at now.
+func (w *rateWindow) add(now time.Time) {
+	sec := now.Unix()
+	i := sec % int64(len(w.counts))
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.seconds[i] != sec {
+		w.seconds[i] = sec
+		w.counts[i] = 0
+	}
+	w.counts[i]++
+}
+
+// perSecond returns the average events per second over the d before now,
+// counting whole seconds and including the current one. d is clamped to
+// [1s, maxRateWindow].
+func (w *rateWindow) perSecond(now time.Time, d time.Duration) float64 {
+	n := int64(min(max((d+time.Second-1)/time.Second, 1), maxRateWindow/time.Second))
+	sec := now.Unix()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var total int64
+	for i := range w.counts {
+		if w.seconds[i] > sec-n && w.seconds[i] <= sec {
+			total += w.counts[i]
+		}
+	}
+	return float64(total) / float64(n)
+}
+
+// topicProgress tracks processed messages of one topic between WithLogEvery
+// log lines.
+type topicProgress struct {
+	count     int64
+	lastLogAt time.Time
+}
+
+func newConsumerState(name string) *consumerState {
+	return &consumerState{
+		name:        name,
+		opts:        defaultConsumerOptions(),
+		pendingAcks: make(map[*primitive.MessageExt]chan consumer.ConsumeResult),
+		topics:      make(map[string]struct{}),
+		progress:    make(map[string]*topicProgress),
+	}
+}
+
+// recordProcessed counts a processed message of topic. Every nth call it
+// returns the running count and the rate in messages per second since the
+// previous nth call, or since the first message for the first one.
+func (s *consumerState) recordProcessed(topic string, n int64, now time.Time) (count int64, rate float64, due bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.progress[topic]
+	if !ok {
+		p = &topicProgress{lastLogAt: now}
+		s.progress[topic] = p
+	}
+	p.count++
+	if p.count%n != 0 {
+		return p.count, 0, false
+	}
+	if elapsed := now.Sub(p.lastLogAt).Seconds(); elapsed > 0 {
+		rate = float64(n) / elapsed
+	}
+	p.lastLogAt = now
+	return p.count, rate, true
+}
+
+// addTopic records topic as subscribed.
+func (s *consumerState) addTopic(topic string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.topics[topic] = struct{}{}
+}
+
+// checkTopic returns ErrTopicMismatch when topics have been subscribed and
+// topic is not one of them.
+func (s *consumerState) checkTopic(topic string) error {
+	s.mu.RLock()
+	_, ok := s.topics[topic]
+	empty := len(s.topics) == 0
+	s.mu.RUnlock()
+	if ok || empty {
+		return nil
+	}
+	return &ErrTopicMismatch{Expected: strings.Join(s.subscribedTopics(), ","), Got: topic}
+}
+
+// subscribedTopics returns the subscribed topics in sorted order.
+func (s *consumerState) subscribedTopics() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// consumerState returns the state for the named consumer, creating it on
+// first use. Only the subscribe path calls it; read-only accessors use
+// lookupConsumerState so unknown names leave no entry behind. An empty name
+// resolves to the default consumer.
+func (r *Client) consumerState(name string) *consumerState {
+	r.mu.RLock()
+	if name == "" {
+		name = r.defaultConsumer
+	}
+	state, ok := r.consumerStates[name]
+	r.mu.RUnlock()
+	if ok {
+		return state
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok = r.consumerStates[name]
+	if !ok {
+		state = newConsumerState(name)
+		r.consumerStates[name] = state
+	}
+	return state
+}
+
+// defaultConsumerName returns the name of the default consumer; it changes
+// on startup and shutdown.
+func (r *Client) defaultConsumerName() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defaultConsumer
+}
+
+// lookupConsumerState returns the state for the named consumer, or nil when
+// nothing was subscribed under that name. An empty name resolves to the
+// default consumer.
+func (r *Client) lookupConsumerState(name string) *consumerState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name == "" {
+		name = r.defaultConsumer
+	}
+	return r.consumerStates[name]
+}
+
+// apply applies opts on top of the current options. If the result is
+// invalid the current options are kept and the error is returned.
+func (s *consumerState) apply(opts ...ConsumerOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := s.opts
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&next)
+		}
+	}
+	if err := next.validate(); err != nil {
+		return err
+	}
+	s.opts = next
+	return nil
+}
+
+// options returns a copy of the current options.
+func (s *consumerState) options() consumerOptions {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.opts
+}
+
+// expectAck registers msg as awaiting a manual ack. Acks are keyed by the
+// delivered message rather than its MsgId, so a redelivered copy with the
+// same MsgId waits for its own ack.
+func (s *consumerState) expectAck(msg *primitive.MessageExt) chan consumer.ConsumeResult {
+	ack := make(chan consumer.ConsumeResult, 1)
+	s.mu.Lock()
+	s.pendingAcks[msg] = ack
+	s.mu.Unlock()
+	return ack
+}
+
+// cancelAck drops the pending ack for msg.
+func (s *consumerState) cancelAck(msg *primitive.MessageExt) {
+	s.mu.Lock()
+	delete(s.pendingAcks, msg)
+	s.mu.Unlock()
+}
+
+// resolveAck delivers outcome to the consume goroutine waiting on msg and
+// reports whether one was waiting.
+func (s *consumerState) resolveAck(msg *primitive.MessageExt, outcome consumer.ConsumeResult) bool {
+	s.mu.Lock()
+	ack, ok := s.pendingAcks[msg]
+	delete(s.pendingAcks, msg)
+	s.mu.Unlock()
+
+	if ok {
+		ack <- outcome
+	}
+	return ok
+}
+
+// awaitAck blocks until AckManually resolves msg, ctx is done, or timeout
+// elapses.
+func (s *consumerState) awaitAck(ctx context.Context, msg *primitive.MessageExt, ack chan consumer.ConsumeResult, timeout time.Duration) (consumer.ConsumeResult, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case outcome := <-ack:
+		return outcome, nil
+	case <-ctx.Done():
+		s.cancelAck(msg)
+		return consumer.ConsumeRetryLater, ctx.Err()
+	case <-timer.C:
+		s.cancelAck(msg)
+		return consumer.ConsumeRetryLater, WrapError(ErrAckTimeout, "message "+msg.MsgId)
+	}
+}
@@ -3,6 +3,7 @@ package rocketmq
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 // Error definitions
@@ -10,6 +11,7 @@ var (
 	// Configuration errors
 	ErrInvalidConfiguration = errors.New("invalid rocketmq configuration")
 	ErrMissingNameServer    = errors.New("name server addresses are required")
+	ErrInvalidNameServer    = errors.New("invalid name server address")
 	ErrInvalidProducer      = errors.New("invalid producer configuration")
 	ErrInvalidConsumer      = errors.New("invalid consumer configuration")
 
@@ -25,16 +27,26 @@ var (
 	ErrInvalidMessage     = errors.New("invalid message")
 	ErrSendMessageFailed  = errors.New("failed to send message")
 	ErrSendMessageTimeout = errors.New("send message timeout")
+	ErrInvalidTopicWeight = errors.New("invalid topic weight")
+	ErrDeliveryTimeInPast = errors.New("delivery time is in the past")
+	ErrShedded            = errors.New("message shed under producer load")
+	ErrHeaderConflict     = errors.New("header conflicts with message property")
 
 	// Consumer errors
 	ErrConsumerNotReady     = errors.New("consumer is not ready")
 	ErrConsumerNotFound     = errors.New("consumer not found")
 	ErrSubscribeFailed      = errors.New("failed to subscribe to topics")
 	ErrConsumeMessageFailed = errors.New("failed to consume message")
+	ErrAutoAckEnabled       = errors.New("consumer acks automatically; subscribe WithManualAck to ack manually")
+	ErrAckNotPending        = errors.New("message is not awaiting a manual ack")
+	ErrAckTimeout           = errors.New("manual ack timeout")
+	ErrNoRouteMatched       = errors.New("no route matched message")
 
 	// Health check errors
 	ErrHealthCheckFailed = errors.New("health check failed")
 	ErrUnhealthy         = errors.New("service is unhealthy")
+	ErrCheckInFlight     = errors.New("health check already in flight")
+	ErrCheckNotFound     = errors.New("health check not found")
 
 	// Retry errors
 	ErrMaxRetriesExceeded = errors.New("max retries exceeded")
@@ -48,6 +60,58 @@ var (
 	ErrInvalidConsumeOrder = errors.New("invalid consume order")
 )
 
+// ErrNoHandlerRegistered is returned by TypeRouter when no handler is
+// registered for a message's type. The message is routed to the DLQ.
+type ErrNoHandlerRegistered struct {
+	Type string
+}
+
+func (e *ErrNoHandlerRegistered) Error() string {
+	return fmt.Sprintf("no handler registered for message type %q", e.Type)
+}
+
+// ErrTLSFingerprintMismatch is returned by connection probes when the
+// NameServer's leaf certificate does not match WithTLSFingerprint.
+type ErrTLSFingerprintMismatch struct {
+	Expected string
+	Got      string
+}
+
+func (e *ErrTLSFingerprintMismatch) Error() string {
+	return fmt.Sprintf("tls certificate fingerprint mismatch: expected %s, got %s", e.Expected, e.Got)
+}
+
+// ErrTopicMismatch is returned by the consume callback for a message whose
+// topic is none of the consumer's subscriptions. Expected lists the
+// subscribed topics, comma-separated.
+type ErrTopicMismatch struct {
+	Expected string
+	Got      string
+}
+
+func (e *ErrTopicMismatch) Error() string {
+	return fmt.Sprintf("received message for unsubscribed topic %q, subscribed to %s", e.Got, e.Expected)
+}
+
+// ErrShutdownPending is returned by GracefulStop when its context expires
+// while sends are still in flight.
+type ErrShutdownPending struct {
+	Count int
+}
+
+func (e *ErrShutdownPending) Error() string {
+	return fmt.Sprintf("shutdown interrupted with %d sends in flight", e.Count)
+}
+
+// RetryAfterError is returned by ConsumeRetryAfter; see there.
+type RetryAfterError struct {
+	Delay time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("consume retry requested after %s", e.Delay)
+}
+
 // Error wrapper with context
 type ErrorWithContext struct {
 	Err     error
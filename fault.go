@@ -0,0 +1,104 @@
+package rocketmq
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+)
+
+type faultKind int
+
+const (
+	faultNone faultKind = iota
+	faultConnectFail
+	faultSlowProbe
+	faultAlternateSuccess
+)
+
+func (k faultKind) String() string {
+	switch k {
+	case faultConnectFail:
+		return "connect_fail"
+	case faultSlowProbe:
+		return "slow_probe"
+	case faultAlternateSuccess:
+		return "alternate_success"
+	default:
+		return "none"
+	}
+}
+
+// Fault describes a failure mode ConnectionManager.InjectFault simulates in
+// NameServer probes. Use FaultConnectFail, FaultSlowProbe or
+// FaultAlternateSuccess.
+type Fault struct {
+	kind  faultKind
+	delay time.Duration
+}
+
+var (
+	// FaultConnectFail makes every probe fail as if the NameServer refused
+	// the connection.
+	FaultConnectFail = Fault{kind: faultConnectFail}
+
+	// FaultAlternateSuccess makes every other probe fail, simulating a
+	// flapping network path.
+	FaultAlternateSuccess = Fault{kind: faultAlternateSuccess}
+)
+
+// FaultSlowProbe delays every probe by d before dialing, simulating a slow
+// network.
+func FaultSlowProbe(d time.Duration) Fault {
+	return Fault{kind: faultSlowProbe, delay: d}
+}
+
+// faultState is the fault currently injected into a ConnectionManager.
+type faultState struct {
+	fault  Fault
+	until  time.Time
+	probes int64
+}
+
+// InjectFault makes NameServer probes behave according to fault for the
+// given duration, after which normal probing resumes. Injecting a new fault
+// replaces the current one. It is intended for chaos testing.
+func (cm *ConnectionManager) InjectFault(fault Fault, duration time.Duration) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.faults = faultState{fault: fault, until: time.Now().Add(duration)}
+	log.Warn("Injected RocketMQ connection fault", "fault", fault.kind, "duration", duration)
+}
+
+// applyFault runs the injected fault, if any, for one probe. A non-nil error
+// fails the probe without dialing.
+func (cm *ConnectionManager) applyFault(ctx context.Context) error {
+	cm.mu.Lock()
+	if cm.faults.fault.kind == faultNone || time.Now().After(cm.faults.until) {
+		cm.faults = faultState{}
+		cm.mu.Unlock()
+		return nil
+	}
+	fault := cm.faults.fault
+	cm.faults.probes++
+	probes := cm.faults.probes
+	cm.mu.Unlock()
+
+	switch fault.kind {
+	case faultConnectFail:
+		return WrapError(ErrConnectionFailed, "injected fault")
+	case faultAlternateSuccess:
+		if probes%2 == 1 {
+			return WrapError(ErrConnectionFailed, "injected fault")
+		}
+	case faultSlowProbe:
+		timer := time.NewTimer(fault.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package rocketmq
+
+import (
+	"context"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+// FireAndForgetProducer publishes messages asynchronously without reporting
+// per-message results to the caller. Failures are counted in the producer
+// failure metrics and passed to the optional error callback, so the aggregate
+// success rate stays visible.
+type FireAndForgetProducer struct {
+	client       *Client
+	producerName string
+	errorFn      func(msg *primitive.Message, err error)
+}
+
+// FireAndForgetOption configures a FireAndForgetProducer.
+type FireAndForgetOption func(*FireAndForgetProducer)
+
+// WithErrorFn sets a callback invoked for every message that fails to be
+// submitted or delivered. It runs on the SDK's callback goroutine for delivery
+// failures and must not block.
+func WithErrorFn(fn func(msg *primitive.Message, err error)) FireAndForgetOption {
+	return func(p *FireAndForgetProducer) {
+		p.errorFn = fn
+	}
+}
+
+// NewFireAndForgetProducer wraps the async send path of the named producer
+// instance. An empty name uses the default producer.
+func NewFireAndForgetProducer(client *Client, producerName string, opts ...FireAndForgetOption) *FireAndForgetProducer {
+	p := &FireAndForgetProducer{
+		client:       client,
+		producerName: producerName,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(p)
+		}
+	}
+	return p
+}
+
+// Publish sends msg asynchronously and returns immediately.
+func (p *FireAndForgetProducer) Publish(ctx context.Context, msg *primitive.Message) {
+	if msg == nil {
+		p.client.producerMetrics(p.producerName).IncrementProducerMessagesFailed()
+		p.reportError(msg, ErrInvalidMessage)
+		return
+	}
+
+	err := p.client.sendAsync(ctx, p.producerName, msg, func(_ *primitive.SendResult, err error) {
+		if err != nil {
+			p.reportError(msg, err)
+		}
+	})
+	if err != nil {
+		p.reportError(msg, err)
+	}
+}
+
+func (p *FireAndForgetProducer) reportError(msg *primitive.Message, err error) {
+	if p.errorFn != nil {
+		p.errorFn(msg, err)
+	}
+}
@@ -1,10 +1,22 @@
 package rocketmq
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-lynx/lynx/log"
@@ -12,25 +24,129 @@ import (
 
 const nameServerProbeTimeout = 3 * time.Second
 
+// latencyEWMAWeight is the weight of the newest sample in the per-address
+// probe latency average.
+const latencyEWMAWeight = 0.3
+
+// DialFunc opens a network connection to addr. It has the same shape as
+// net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
 // ConnectionManager manages connection health and reconnection
 type ConnectionManager struct {
 	metrics         *Metrics
 	healthChecker   *HealthChecker
 	nameServerAddrs []string
+	dialFunc        DialFunc
+	stopCh          <-chan struct{}
+	hcOpts          []HealthCheckerOption
 	mu              sync.RWMutex
 	connected       bool
 	cancel          context.CancelFunc
 	wg              sync.WaitGroup
+
+	// probing counts in-flight probes; lastProbeOK records whether the most
+	// recent completed probe succeeded.
+	probing     int32
+	lastProbeOK bool
+
+	// faults is the fault injected by InjectFault, if any
+	faults faultState
+
+	// TLS settings for probes; probes are plain TCP when both are unset
+	tlsConfig      *tls.Config
+	tlsFingerprint string
+
+	// Reported by MetricsSnapshot
+	lastProbeAt      time.Time
+	lastReconnectAt  time.Time
+	activeNameServer string
+
+	// EWMA of successful probe latency per NameServer address
+	latencies map[string]time.Duration
+
+	// Gates added with AddReadinessGate, keyed by name
+	readinessGates map[string]func() bool
+}
+
+// ConnectionManagerOption configures a ConnectionManager at construction time.
+type ConnectionManagerOption func(*ConnectionManager)
+
+// WithDialFunc replaces the TCP dialer used to probe NameServer addresses.
+// Tests can use it to inject mock connections, and production code can route
+// probes through a custom transport such as a SOCKS5 proxy.
+func WithDialFunc(fn DialFunc) ConnectionManagerOption {
+	return func(cm *ConnectionManager) {
+		cm.dialFunc = fn
+	}
+}
+
+// WithDialerOptions probes NameServer addresses with a copy of d, giving full
+// control over the TCP dial: Timeout, KeepAlive, LocalAddr to bind to a
+// specific NIC on multi-homed hosts, Control for socket options, and so on.
+// It replaces any earlier WithDialFunc, and vice versa.
+func WithDialerOptions(d net.Dialer) ConnectionManagerOption {
+	return func(cm *ConnectionManager) {
+		cm.dialFunc = d.DialContext
+	}
+}
+
+// WithCustomStopCh ties the manager's lifecycle to an external signal: once ch
+// is closed the manager stops itself, with no explicit Stop call needed.
+func WithCustomStopCh(ch <-chan struct{}) ConnectionManagerOption {
+	return func(cm *ConnectionManager) {
+		cm.stopCh = ch
+	}
+}
+
+// WithHealthCheckerOptions passes opts to the manager's HealthChecker.
+func WithHealthCheckerOptions(opts ...HealthCheckerOption) ConnectionManagerOption {
+	return func(cm *ConnectionManager) {
+		cm.hcOpts = append(cm.hcOpts, opts...)
+	}
+}
+
+// WithTLSConfig makes probes complete a TLS handshake, validated against cfg,
+// instead of only opening a TCP connection.
+func WithTLSConfig(cfg *tls.Config) ConnectionManagerOption {
+	return func(cm *ConnectionManager) {
+		cm.tlsConfig = cfg
+	}
+}
+
+// WithTLSFingerprint makes probes complete a TLS handshake and additionally
+// require the server's leaf certificate to have the given SHA-256
+// fingerprint (hex, colons optional). Pinning the certificate guards against
+// a compromised CA in environments with a custom CA; a mismatch fails the
+// probe with *ErrTLSFingerprintMismatch. Standard validation uses the
+// WithTLSConfig config, or the system roots when none is set.
+func WithTLSFingerprint(sha256Hex string) ConnectionManagerOption {
+	return func(cm *ConnectionManager) {
+		cm.tlsFingerprint = strings.ToLower(strings.ReplaceAll(sha256Hex, ":", ""))
+	}
 }
 
 // NewConnectionManager creates a new connection manager.
 // If nameServerAddrs is non-empty, checkConnection will probe RocketMQ by TCP dial to one of the NameServer addresses.
-func NewConnectionManager(metrics *Metrics, nameServerAddrs []string) *ConnectionManager {
+func NewConnectionManager(metrics *Metrics, nameServerAddrs []string, opts ...ConnectionManagerOption) *ConnectionManager {
 	cm := &ConnectionManager{
 		metrics:         metrics,
-		nameServerAddrs: nameServerAddrs,
+		nameServerAddrs: slices.Clone(nameServerAddrs),
+		latencies:       make(map[string]time.Duration),
+		readinessGates:  make(map[string]func() bool),
 	}
-	cm.healthChecker = NewHealthChecker(metrics, cm)
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cm)
+		}
+	}
+	if cm.dialFunc == nil {
+		// No dialer timeout: the probe context carries the deadline, which
+		// follows the health checker's escalated timeout.
+		dialer := &net.Dialer{}
+		cm.dialFunc = dialer.DialContext
+	}
+	cm.healthChecker = NewHealthChecker(metrics, cm, cm.hcOpts...)
 	return cm
 }
 
@@ -44,6 +160,13 @@ func (cm *ConnectionManager) StartWithContext(ctx context.Context) error {
 	if err := ctx.Err(); err != nil {
 		return err
 	}
+	if cm.stopCh != nil {
+		select {
+		case <-cm.stopCh:
+			return WrapError(ErrConnectionClosed, "external stop channel already closed")
+		default:
+		}
+	}
 
 	cm.mu.Lock()
 	if cm.cancel != nil {
@@ -74,6 +197,18 @@ func (cm *ConnectionManager) StartWithContext(ctx context.Context) error {
 		cm.run(runCtx)
 	}()
 
+	// The watcher is deliberately outside wg: it calls Stop, which waits on wg.
+	if cm.stopCh != nil {
+		go func() {
+			select {
+			case <-cm.stopCh:
+				log.Info("Stopping RocketMQ connection manager on external stop signal")
+				cm.Stop()
+			case <-runCtx.Done():
+			}
+		}()
+	}
+
 	return nil
 }
 
@@ -91,11 +226,137 @@ func (cm *ConnectionManager) Stop() {
 	cm.wg.Wait()
 }
 
-// IsConnected checks if connected
+// IsConnected checks if connected. While a probe is in progress it reports
+// false unless the previous probe succeeded, so state restored from a
+// checkpoint is not trusted once re-verification has started.
 func (cm *ConnectionManager) IsConnected() bool {
+	connecting := cm.IsConnecting()
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
-	return cm.connected
+	return cm.connectedLocked(connecting)
+}
+
+// connectedLocked applies the IsConnected rule; cm.mu must be held.
+func (cm *ConnectionManager) connectedLocked(connecting bool) bool {
+	return cm.connected && (!connecting || cm.lastProbeOK)
+}
+
+// IsConnecting reports whether a connection probe is in progress. Together
+// with IsConnected it distinguishes "checking" from "never connected".
+func (cm *ConnectionManager) IsConnecting() bool {
+	return atomic.LoadInt32(&cm.probing) > 0
+}
+
+// WatchHealthChecker returns a channel receiving a HealthSnapshot on every
+// health check cycle; see HealthChecker.Watch. The buffer depth is set with
+// WithHealthCheckerOptions(WithHealthWatchBuffer(n)).
+func (cm *ConnectionManager) WatchHealthChecker() <-chan HealthSnapshot {
+	return cm.healthChecker.Watch()
+}
+
+// Runnable is a component started with a context that runs until the
+// context is cancelled. It has the shape of controller-runtime's
+// manager.Runnable.
+type Runnable interface {
+	Start(ctx context.Context) error
+}
+
+// connectionManagerRunnable adapts a ConnectionManager to Runnable.
+type connectionManagerRunnable struct {
+	cm *ConnectionManager
+}
+
+func (r connectionManagerRunnable) Start(ctx context.Context) error {
+	if err := r.cm.StartWithContext(ctx); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	r.cm.Stop()
+	return nil
+}
+
+// Runnable returns an adapter that starts the manager and stops it when the
+// context is cancelled. Together with ReadyzCheck it lets Kubernetes
+// operators include RocketMQ connectivity in their controller readiness
+// without this plugin depending on controller-runtime:
+//
+//	_ = mgr.Add(cm.Runnable())
+//	_ = mgr.AddReadyzCheck("rocketmq", cm.ReadyzCheck)
+func (cm *ConnectionManager) Runnable() Runnable {
+	return connectionManagerRunnable{cm: cm}
+}
+
+// ReadyzCheck reports an error while the manager is not connected. It has
+// the shape of controller-runtime's healthz.Checker.
+func (cm *ConnectionManager) ReadyzCheck(_ *http.Request) error {
+	if !cm.IsConnected() {
+		return WrapError(ErrUnhealthy, "rocketmq nameserver not connected")
+	}
+	return nil
+}
+
+// AddReadinessGate registers a named condition that must hold before
+// IsReadyForTraffic reports ready, e.g. a cache warm-up finishing. open is
+// called on every IsReadyForTraffic call and must be cheap. Adding a gate
+// under an existing name replaces it.
+func (cm *ConnectionManager) AddReadinessGate(name string, open func() bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.readinessGates[name] = open
+}
+
+// IsReadyForTraffic reports whether the manager is connected, its health
+// checker is healthy and every readiness gate is open: a single assertion
+// for HTTP readiness probes.
+func (cm *ConnectionManager) IsReadyForTraffic() bool {
+	if !cm.IsConnected() || !cm.healthChecker.IsHealthy() {
+		return false
+	}
+	cm.mu.RLock()
+	gates := make(map[string]func() bool, len(cm.readinessGates))
+	for name, open := range cm.readinessGates {
+		gates[name] = open
+	}
+	cm.mu.RUnlock()
+
+	for name, open := range gates {
+		if !open() {
+			log.Debug("RocketMQ readiness gate closed", "gate", name)
+			return false
+		}
+	}
+	return true
+}
+
+// AllHealthy reports whether every given manager is connected, for composite
+// readiness probes over managers of different topics or regions. A nil
+// manager counts as disconnected; with no managers it returns true.
+func AllHealthy(managers ...*ConnectionManager) bool {
+	for _, cm := range managers {
+		if cm == nil || !cm.IsConnected() {
+			return false
+		}
+	}
+	return true
+}
+
+// AnyHealthy reports whether at least one of the given managers is connected.
+func AnyHealthy(managers ...*ConnectionManager) bool {
+	for _, cm := range managers {
+		if cm != nil && cm.IsConnected() {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns a one-line summary of the manager state for logs.
+func (cm *ConnectionManager) String() string {
+	connecting := cm.IsConnecting()
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return fmt.Sprintf("ConnectionManager{connected:%t, connecting:%t, nameServers:%v}",
+		cm.connectedLocked(connecting), connecting, cm.nameServerAddrs)
 }
 
 // GetHealthChecker gets health checker
@@ -109,10 +370,139 @@ func (cm *ConnectionManager) ForceReconnect() {
 	defer cm.mu.Unlock()
 
 	cm.connected = false
+	cm.lastReconnectAt = time.Now()
 	cm.metrics.IncrementReconnectionCount()
 	log.Info("Forced reconnection")
 }
 
+// SetMetrics replaces the metrics the manager and its health checker record
+// to, e.g. moving from an isolated instance used during startup to the
+// client's registered one, without restarting the manager. Counters already
+// recorded stay on the old instance. A nil m is ignored.
+func (cm *ConnectionManager) SetMetrics(m *Metrics) {
+	if m == nil {
+		return
+	}
+	cm.mu.Lock()
+	cm.metrics = m
+	cm.mu.Unlock()
+
+	cm.healthChecker.mu.Lock()
+	cm.healthChecker.metrics = m
+	cm.healthChecker.mu.Unlock()
+	log.Info("Swapped RocketMQ connection manager metrics", "nameServers", cm.addrs())
+}
+
+// Connection states reported by MetricsSnapshot.CurrentState.
+const (
+	ConnectionStateConnected    = "connected"
+	ConnectionStateConnecting   = "connecting"
+	ConnectionStateDisconnected = "disconnected"
+)
+
+// MetricsSnapshot is the client metrics plus the connection manager's own
+// observable state.
+type MetricsSnapshot struct {
+	Stats
+
+	CurrentState     string
+	LastReconnectAt  time.Time
+	LastProbeAt      time.Time
+	ActiveNameServer string
+}
+
+// MetricsSnapshot returns the current metrics together with the manager's
+// connection state, last forced reconnect, last probe time and the
+// NameServer that answered the last successful probe. Metrics are shared by
+// all managers of a client, while the other fields are per manager.
+func (cm *ConnectionManager) MetricsSnapshot() MetricsSnapshot {
+	connecting := cm.IsConnecting()
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	state := ConnectionStateDisconnected
+	if cm.connectedLocked(connecting) {
+		state = ConnectionStateConnected
+	} else if connecting {
+		state = ConnectionStateConnecting
+	}
+	return MetricsSnapshot{
+		Stats:            cm.metrics.GetStats(),
+		CurrentState:     state,
+		LastReconnectAt:  cm.lastReconnectAt,
+		LastProbeAt:      cm.lastProbeAt,
+		ActiveNameServer: cm.activeNameServer,
+	}
+}
+
+// SetNameServerAddrs validates addrs and atomically replaces the NameServer
+// address list, then probes the new addresses immediately. A failed probe is
+// reflected in IsConnected rather than returned.
+func (cm *ConnectionManager) SetNameServerAddrs(addrs []string) error {
+	if len(addrs) == 0 {
+		return ErrMissingNameServer
+	}
+	for _, addr := range addrs {
+		if err := validateNameServerAddr(addr); err != nil {
+			return err
+		}
+	}
+
+	cm.mu.Lock()
+	cm.nameServerAddrs = append([]string(nil), addrs...)
+	for addr := range cm.latencies {
+		if !slices.Contains(addrs, addr) {
+			delete(cm.latencies, addr)
+		}
+	}
+	cm.mu.Unlock()
+	log.Info("Updated RocketMQ NameServer addresses", "addrs", addrs)
+
+	if err := cm.checkConnectionContext(context.Background()); err != nil {
+		log.Warn("RocketMQ connection probe failed after NameServer update", "addrs", addrs, "error", err)
+	}
+	return nil
+}
+
+// ConnectionCheckpoint is a serializable snapshot of ConnectionManager state,
+// used to warm-start a manager after a process restart.
+type ConnectionCheckpoint struct {
+	NameServerAddrs []string  `json:"name_server_addrs"`
+	Connected       bool      `json:"connected"`
+	CapturedAt      time.Time `json:"captured_at"`
+}
+
+// Checkpoint captures the current NameServer addresses and connection state.
+func (cm *ConnectionManager) Checkpoint() ConnectionCheckpoint {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return ConnectionCheckpoint{
+		NameServerAddrs: append([]string(nil), cm.nameServerAddrs...),
+		Connected:       cm.connected,
+		CapturedAt:      time.Now(),
+	}
+}
+
+// RestoreFromCheckpoint replaces the NameServer addresses and connection state
+// with those captured in cp. The restored state is trusted until the next probe.
+func (cm *ConnectionManager) RestoreFromCheckpoint(cp ConnectionCheckpoint) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.nameServerAddrs = append([]string(nil), cp.NameServerAddrs...)
+	cm.connected = cp.Connected
+	cm.lastProbeOK = false
+	log.Info("Restored RocketMQ connection manager from checkpoint", "addrs", cm.nameServerAddrs, "connected", cp.Connected, "capturedAt", cp.CapturedAt)
+}
+
+// addrs returns a snapshot of the configured NameServer addresses.
+func (cm *ConnectionManager) addrs() []string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return slices.Clone(cm.nameServerAddrs)
+}
+
 // run runs the connection manager loop
 func (cm *ConnectionManager) run(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
@@ -124,7 +514,7 @@ func (cm *ConnectionManager) run(ctx context.Context) {
 			return
 		case <-ticker.C:
 			if err := cm.checkConnectionContext(ctx); err != nil {
-				log.Debug("RocketMQ connection probe failed", "addrs", cm.nameServerAddrs, "error", err)
+				log.Debug("RocketMQ connection probe failed", "addrs", cm.addrs(), "error", err)
 			}
 		}
 	}
@@ -132,64 +522,451 @@ func (cm *ConnectionManager) run(ctx context.Context) {
 
 // checkConnectionContext checks connection health by probing NameServer when addresses are configured.
 func (cm *ConnectionManager) checkConnectionContext(ctx context.Context) error {
-	if len(cm.nameServerAddrs) == 0 {
-		cm.mu.Lock()
-		cm.connected = true
-		cm.mu.Unlock()
+	addrs := cm.addrs()
+	if len(addrs) == 0 {
+		cm.setProbeResult(true, "")
 		return nil
 	}
 
-	dialer := &net.Dialer{Timeout: nameServerProbeTimeout}
+	atomic.AddInt32(&cm.probing, 1)
+	defer atomic.AddInt32(&cm.probing, -1)
+
 	var lastErr error
-	for _, addr := range cm.nameServerAddrs {
+	for _, addr := range addrs {
 		if err := ctx.Err(); err != nil {
-			cm.mu.Lock()
-			cm.connected = false
-			cm.mu.Unlock()
+			cm.setProbeResult(false, "")
 			return err
 		}
 
-		probeCtx, cancel := context.WithTimeout(ctx, nameServerProbeTimeout)
-		conn, err := dialer.DialContext(probeCtx, "tcp", addr)
-		cancel()
+		err := cm.probe(ctx, addr)
 		if err == nil {
-			_ = conn.Close()
-			cm.mu.Lock()
-			cm.connected = true
-			cm.mu.Unlock()
+			cm.setProbeResult(true, addr)
 			return nil
 		}
 		lastErr = err
 	}
-	cm.mu.Lock()
-	cm.connected = false
-	cm.mu.Unlock()
+	cm.setProbeResult(false, "")
 	if lastErr == nil {
 		lastErr = fmt.Errorf("rocketmq nameserver probe failed")
 	}
 	return lastErr
 }
 
+// setProbeResult records the outcome of a completed probe; addr is the
+// NameServer that answered, if any.
+func (cm *ConnectionManager) setProbeResult(ok bool, addr string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.connected = ok
+	cm.lastProbeOK = ok
+	cm.lastProbeAt = time.Now()
+	cm.activeNameServer = addr
+}
+
+// probeTimeout returns the per-probe timeout: the health checker's current
+// check timeout when WithTimeoutEscalation is set, nameServerProbeTimeout
+// otherwise.
+func (cm *ConnectionManager) probeTimeout() time.Duration {
+	if cm.healthChecker != nil {
+		if timeout := cm.healthChecker.CheckTimeout(); timeout > 0 {
+			return timeout
+		}
+	}
+	return nameServerProbeTimeout
+}
+
+// probe dials addr once and closes the connection on success. The latency of
+// a successful probe is folded into the address's EWMA.
+func (cm *ConnectionManager) probe(ctx context.Context, addr string) error {
+	probeCtx, cancel := context.WithTimeout(ctx, cm.probeTimeout())
+	defer cancel()
+
+	start := time.Now()
+	if err := cm.applyFault(probeCtx); err != nil {
+		return err
+	}
+	conn, err := cm.dial(probeCtx, addr)
+	if err != nil {
+		return err
+	}
+	_ = conn.Close()
+	cm.recordLatency(addr, time.Since(start))
+	return nil
+}
+
+// dial connects to addr with the manager's dialer, completing and verifying
+// a TLS handshake when TLS is configured.
+func (cm *ConnectionManager) dial(ctx context.Context, addr string) (net.Conn, error) {
+	conn, err := cm.dialFunc(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if cm.tlsConfig == nil && cm.tlsFingerprint == "" {
+		return conn, nil
+	}
+	tlsConn, err := cm.verifyTLS(ctx, conn, addr)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// recordLatency folds a successful probe latency into addr's EWMA.
+func (cm *ConnectionManager) recordLatency(addr string, d time.Duration) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if prev, ok := cm.latencies[addr]; ok {
+		d = time.Duration(latencyEWMAWeight*float64(d) + (1-latencyEWMAWeight)*float64(prev))
+	}
+	cm.latencies[addr] = d
+}
+
+// AddressLatency is the probe latency EWMA of one NameServer address.
+type AddressLatency struct {
+	Addr    string        `json:"addr"`
+	Latency time.Duration `json:"latency"`
+}
+
+// AddressLatencyIndex returns the EWMA of successful probe latency for each
+// NameServer address that has answered at least one probe, fastest first.
+func (cm *ConnectionManager) AddressLatencyIndex() []AddressLatency {
+	cm.mu.RLock()
+	index := make([]AddressLatency, 0, len(cm.latencies))
+	for addr, d := range cm.latencies {
+		index = append(index, AddressLatency{Addr: addr, Latency: d})
+	}
+	cm.mu.RUnlock()
+
+	slices.SortFunc(index, func(a, b AddressLatency) int {
+		if c := cmp.Compare(a.Latency, b.Latency); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Addr, b.Addr)
+	})
+	return index
+}
+
+// verifyTLS performs a TLS handshake over conn and checks the pinned
+// certificate fingerprint, if any.
+func (cm *ConnectionManager) verifyTLS(ctx context.Context, conn net.Conn, addr string) (*tls.Conn, error) {
+	cfg := &tls.Config{}
+	if cm.tlsConfig != nil {
+		cfg = cm.tlsConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, WrapError(ErrInvalidNameServer, addr)
+		}
+		cfg.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, WrapError(err, "tls handshake with "+addr)
+	}
+	if cm.tlsFingerprint == "" {
+		return tlsConn, nil
+	}
+
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, &ErrTLSFingerprintMismatch{Expected: cm.tlsFingerprint}
+	}
+	sum := sha256.Sum256(certs[0].Raw)
+	if got := hex.EncodeToString(sum[:]); got != cm.tlsFingerprint {
+		return nil, &ErrTLSFingerprintMismatch{Expected: cm.tlsFingerprint, Got: got}
+	}
+	return tlsConn, nil
+}
+
+// ProbeResult is the outcome of probing a single NameServer address.
+type ProbeResult struct {
+	Success bool          `json:"success"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// ProbeAll probes every configured NameServer address in parallel and returns
+// the result for each, keyed by address. Unlike IsConnected, which only
+// reports whether some address is reachable, it shows per-server connectivity.
+// ProbeAll does not change the manager's connection state.
+func (cm *ConnectionManager) ProbeAll(ctx context.Context) map[string]ProbeResult {
+	addrs := cm.addrs()
+	results := make(map[string]ProbeResult, len(addrs))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			start := time.Now()
+			err := cm.probe(ctx, addr)
+			result := ProbeResult{Success: err == nil, Latency: time.Since(start)}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			results[addr] = result
+			mu.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+	return results
+}
+
+// HealthCheckFunc is a named check registered with HealthChecker.AddCheck.
+// A non-nil error marks the check, and therefore the checker, unhealthy.
+type HealthCheckFunc func(ctx context.Context) error
+
 // HealthChecker performs health checks
 type HealthChecker struct {
-	metrics    *Metrics
-	connMgr    *ConnectionManager
-	mu         sync.RWMutex
-	healthy    bool
-	lastCheck  time.Time
-	errorCount int64
-	cancel     context.CancelFunc
-	wg         sync.WaitGroup
+	metrics      *Metrics
+	connMgr      *ConnectionManager
+	opts         healthCheckerOptions
+	mu           sync.RWMutex
+	checks       map[string]HealthCheckFunc
+	healthy      bool
+	withinSLA    bool
+	lastCheck    time.Time
+	lastDuration time.Duration
+	errorCount   int64
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	// stopped is set by Stop and cleared by Start; scheduled checks skip a
+	// stopped checker
+	stopped bool
+
+	// Streaks of consecutive healthy and unhealthy check cycles
+	consecutiveSuccesses int64
+	consecutiveFailures  int64
+
+	// Channels returned by Watch, closed on Stop
+	watchers []chan HealthSnapshot
+
+	// Most recent check outcomes, oldest first, for Export
+	history []HealthSnapshot
+
+	// checkInFlight is 1 while a CheckAsync check runs
+	checkInFlight int32
+
+	// Start of the current healthy streak; zero while unhealthy
+	healthySince time.Time
+
+	// Why the last check failed; empty after a healthy check
+	lastFailureReason string
+
+	// Escalated per-check timeout and the streak of checks that did not time
+	// out since the last escalation, for WithTimeoutEscalation
+	checkTimeout     time.Duration
+	nonTimeoutStreak int
+}
+
+// HealthSnapshot is the outcome of one health check cycle.
+type HealthSnapshot struct {
+	Healthy    bool      `json:"healthy"`
+	ErrorCount int64     `json:"error_count"`
+	At         time.Time `json:"at"`
+}
+
+// defaultHealthHistorySize is the number of snapshots kept for Export unless
+// WithHealthHistorySize says otherwise.
+const defaultHealthHistorySize = 100
+
+// defaultHealthWatchBuffer is the channel depth used by Watch unless
+// WithHealthWatchBuffer says otherwise.
+const defaultHealthWatchBuffer = 16
+
+// healthCheckerOptions is the static configuration of a HealthChecker.
+type healthCheckerOptions struct {
+	slaMaxResponseTime time.Duration
+	watchBuffer        int
+	historySize        int
+	minHealthyDuration time.Duration
+
+	// Per-check timeout escalation; disabled when timeoutBase is zero
+	timeoutBase   time.Duration
+	timeoutMax    time.Duration
+	timeoutFactor float64
+}
+
+// HealthCheckerOption configures a HealthChecker at construction time.
+type HealthCheckerOption func(*healthCheckerOptions)
+
+// WithHealthCheckSLA marks the checker as degraded, though still healthy, when
+// a check passes but takes longer than maxResponseTime. It catches a NameServer
+// that responds slowly without timing out.
+func WithHealthCheckSLA(maxResponseTime time.Duration) HealthCheckerOption {
+	return func(o *healthCheckerOptions) {
+		o.slaMaxResponseTime = maxResponseTime
+	}
+}
+
+// WithHealthWatchBuffer sets the buffer depth of channels returned by Watch.
+// Snapshots are dropped rather than blocking the checker when a watcher
+// falls more than n cycles behind.
+func WithHealthWatchBuffer(n int) HealthCheckerOption {
+	return func(o *healthCheckerOptions) {
+		o.watchBuffer = n
+	}
+}
+
+// WithHealthHistorySize sets how many recent check outcomes are kept for
+// Export.
+func WithHealthHistorySize(n int) HealthCheckerOption {
+	return func(o *healthCheckerOptions) {
+		o.historySize = n
+	}
+}
+
+// RequireMinHealthyDuration keeps IsHealthy false until checks have passed
+// continuously for at least d, so a brief recovery of a flapping NameServer
+// does not report the checker healthy before the connection is stable.
+func RequireMinHealthyDuration(d time.Duration) HealthCheckerOption {
+	return func(o *healthCheckerOptions) {
+		o.minHealthyDuration = d
+	}
+}
+
+// WithTimeoutEscalation bounds each health check cycle by a timeout that
+// starts at base and is multiplied by factor, up to max, after every cycle
+// that times out, so a NameServer that has become slow is not declared down
+// by checks that give up too early. The timeout returns to base after two
+// consecutive cycles that finish in time.
+func WithTimeoutEscalation(base, max time.Duration, factor float64) HealthCheckerOption {
+	return func(o *healthCheckerOptions) {
+		o.timeoutBase = base
+		o.timeoutMax = max
+		o.timeoutFactor = factor
+	}
 }
 
 // NewHealthChecker creates a new health checker. When connMgr is non-nil and has NameServer addrs,
 // healthy is derived from connMgr.IsConnected(); otherwise from error count heuristic.
-func NewHealthChecker(metrics *Metrics, connMgr *ConnectionManager) *HealthChecker {
-	return &HealthChecker{
+func NewHealthChecker(metrics *Metrics, connMgr *ConnectionManager, opts ...HealthCheckerOption) *HealthChecker {
+	hc := &HealthChecker{
 		metrics:   metrics,
 		connMgr:   connMgr,
+		checks:    make(map[string]HealthCheckFunc),
+		withinSLA: true,
 		lastCheck: time.Now(),
+		opts: healthCheckerOptions{
+			watchBuffer: defaultHealthWatchBuffer,
+			historySize: defaultHealthHistorySize,
+		},
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&hc.opts)
+		}
+	}
+	return hc
+}
+
+// Clone returns a stopped checker with the same configuration and named
+// checks as hc but fresh state: no errors, history or watchers.
+func (hc *HealthChecker) Clone() *HealthChecker {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	clone := NewHealthChecker(hc.metrics, hc.connMgr)
+	clone.opts = hc.opts
+	for name, check := range hc.checks {
+		clone.checks[name] = check
+	}
+	return clone
+}
+
+// CheckAsync runs a health check in a new goroutine and passes the result to
+// callback: healthy is the outcome, and err is ErrHealthCheckFailed when the
+// check ran but failed. Only one async check runs at a time; while one is in
+// flight, callback is invoked immediately with ErrCheckInFlight.
+func (hc *HealthChecker) CheckAsync(callback func(healthy bool, err error)) {
+	if !atomic.CompareAndSwapInt32(&hc.checkInFlight, 0, 1) {
+		callback(false, ErrCheckInFlight)
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&hc.checkInFlight, 0)
+		hc.performHealthCheck(context.Background())
+		if hc.IsHealthy() {
+			callback(true, nil)
+		} else {
+			callback(false, ErrHealthCheckFailed)
+		}
+	}()
+}
+
+// ScheduledCheck runs a health check at at, or immediately if at is in the
+// past, and sends its outcome, as reported by IsHealthy, on the returned
+// channel, which is then closed. Use it to confirm health at a specific point
+// in a workflow, such as just before a batch job starts.
+func (hc *HealthChecker) ScheduledCheck(at time.Time) <-chan bool {
+	return hc.ScheduledCheckWithContext(context.Background(), at)
+}
+
+// ScheduledCheckWithContext is ScheduledCheck with a context that cancels the
+// pending check and bounds the check itself. If ctx is done or the checker
+// has been stopped by the scheduled time, no check runs and the channel is
+// closed without a value.
+func (hc *HealthChecker) ScheduledCheckWithContext(ctx context.Context, at time.Time) <-chan bool {
+	result := make(chan bool, 1)
+	// The timer may fire before the ctx watch below is registered, so the
+	// watch is handed over rather than read from a shared variable.
+	watch := make(chan func() bool, 1)
+	timer := time.AfterFunc(time.Until(at), func() {
+		defer close(result)
+		stopWatch := <-watch
+		stopWatch()
+		hc.mu.RLock()
+		stopped := hc.stopped
+		hc.mu.RUnlock()
+		if stopped || ctx.Err() != nil {
+			return
+		}
+		hc.performHealthCheck(ctx)
+		result <- hc.IsHealthy()
+	})
+	watch <- context.AfterFunc(ctx, func() {
+		if timer.Stop() {
+			close(result)
+		}
+	})
+	return result
+}
+
+// Watch returns a channel that receives a HealthSnapshot after every health
+// check cycle. The channel is closed when the checker stops.
+func (hc *HealthChecker) Watch() <-chan HealthSnapshot {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	ch := make(chan HealthSnapshot, max(hc.opts.watchBuffer, 0))
+	hc.watchers = append(hc.watchers, ch)
+	return ch
+}
+
+// AddCheck registers a named check that runs on every health check cycle.
+// Registering an existing name replaces the previous check.
+func (hc *HealthChecker) AddCheck(name string, check HealthCheckFunc) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.checks[name] = check
+}
+
+// Unregister removes the named check added with AddCheck, along with its
+// status metric. It returns ErrCheckNotFound if no such check exists.
+func (hc *HealthChecker) Unregister(name string) error {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if _, ok := hc.checks[name]; !ok {
+		return WrapError(ErrCheckNotFound, name)
 	}
+	delete(hc.checks, name)
+	hc.metrics.DeleteHealthCheckStatus(name)
+	return nil
 }
 
 // Start starts health check
@@ -210,6 +987,7 @@ func (hc *HealthChecker) StartWithContext(ctx context.Context) {
 	}
 	runCtx, cancel := context.WithCancel(ctx)
 	hc.cancel = cancel
+	hc.stopped = false
 	hc.mu.Unlock()
 
 	hc.wg.Add(1)
@@ -229,19 +1007,36 @@ func (hc *HealthChecker) Stop() {
 	hc.mu.Lock()
 	cancel := hc.cancel
 	hc.cancel = nil
+	hc.stopped = true
 	hc.mu.Unlock()
 
 	if cancel != nil {
 		cancel()
 	}
 	hc.wg.Wait()
+
+	hc.mu.Lock()
+	for _, ch := range hc.watchers {
+		close(ch)
+	}
+	hc.watchers = nil
+	hc.mu.Unlock()
 }
 
-// IsHealthy checks if healthy
+// IsHealthy checks if healthy. With RequireMinHealthyDuration it stays false
+// until the current healthy streak is old enough.
 func (hc *HealthChecker) IsHealthy() bool {
 	hc.mu.RLock()
 	defer hc.mu.RUnlock()
-	return hc.healthy
+	return hc.isHealthyLocked()
+}
+
+// isHealthyLocked is IsHealthy for callers that hold mu.
+func (hc *HealthChecker) isHealthyLocked() bool {
+	if !hc.healthy {
+		return false
+	}
+	return hc.opts.minHealthyDuration <= 0 || time.Since(hc.healthySince) >= hc.opts.minHealthyDuration
 }
 
 // GetLastCheck gets last check time
@@ -251,6 +1046,56 @@ func (hc *HealthChecker) GetLastCheck() time.Time {
 	return hc.lastCheck
 }
 
+// LastDuration returns how long the last health check took.
+func (hc *HealthChecker) LastDuration() time.Duration {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	return hc.lastDuration
+}
+
+// IsWithinSLA reports whether the last check finished within the SLA set by
+// WithHealthCheckSLA. It is always true when no SLA is configured.
+func (hc *HealthChecker) IsWithinSLA() bool {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	return hc.withinSLA
+}
+
+// CheckTimeout returns the timeout applied to the next check cycle, or zero
+// when WithTimeoutEscalation is not set.
+func (hc *HealthChecker) CheckTimeout() time.Duration {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	if hc.checkTimeout == 0 {
+		return hc.opts.timeoutBase
+	}
+	return hc.checkTimeout
+}
+
+// escalateTimeout updates the check timeout after a cycle. Callers hold mu.
+func (hc *HealthChecker) escalateTimeout(timedOut bool) {
+	current := hc.checkTimeout
+	if current == 0 {
+		current = hc.opts.timeoutBase
+	}
+	if timedOut {
+		hc.nonTimeoutStreak = 0
+		next := time.Duration(float64(current) * hc.opts.timeoutFactor)
+		if hc.opts.timeoutMax > 0 && next > hc.opts.timeoutMax {
+			next = hc.opts.timeoutMax
+		}
+		if next > current {
+			log.Warn("Health check timed out, escalating timeout", "timeout", current, "next", next)
+			hc.checkTimeout = next
+		}
+		return
+	}
+	hc.nonTimeoutStreak++
+	if hc.nonTimeoutStreak >= 2 {
+		hc.checkTimeout = hc.opts.timeoutBase
+	}
+}
+
 // GetErrorCount gets error count
 func (hc *HealthChecker) GetErrorCount() int {
 	hc.mu.RLock()
@@ -258,6 +1103,72 @@ func (hc *HealthChecker) GetErrorCount() int {
 	return int(hc.errorCount)
 }
 
+// MarshalJSON encodes the checker state for HTTP health endpoints:
+//
+//	{"healthy":true,"lastCheck":"...","errorCount":0,"consecutiveSuccesses":5,"consecutiveFailures":0,"lastFailureReason":""}
+//
+// healthy is IsHealthy, so it honours RequireMinHealthyDuration.
+func (hc *HealthChecker) MarshalJSON() ([]byte, error) {
+	hc.mu.RLock()
+	state := struct {
+		Healthy              bool      `json:"healthy"`
+		LastCheck            time.Time `json:"lastCheck"`
+		ErrorCount           int64     `json:"errorCount"`
+		ConsecutiveSuccesses int64     `json:"consecutiveSuccesses"`
+		ConsecutiveFailures  int64     `json:"consecutiveFailures"`
+		LastFailureReason    string    `json:"lastFailureReason"`
+	}{
+		Healthy:              hc.isHealthyLocked(),
+		LastCheck:            hc.lastCheck,
+		ErrorCount:           hc.errorCount,
+		ConsecutiveSuccesses: hc.consecutiveSuccesses,
+		ConsecutiveFailures:  hc.consecutiveFailures,
+		LastFailureReason:    hc.lastFailureReason,
+	}
+	hc.mu.RUnlock()
+	return json.Marshal(state)
+}
+
+// String returns a one-line summary of the checker state for logs; healthy
+// is IsHealthy, as in MarshalJSON.
+func (hc *HealthChecker) String() string {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	return fmt.Sprintf("HealthChecker{healthy:%t, errorCount:%d, lastCheck:%s, consecutiveSuccesses:%d, consecutiveFailures:%d}",
+		hc.isHealthyLocked(), hc.errorCount, hc.lastCheck.UTC().Format(time.RFC3339), hc.consecutiveSuccesses, hc.consecutiveFailures)
+}
+
+// Export returns a reader streaming the recent check history as
+// newline-delimited JSON, oldest first, e.g. io.Copy(logFile, hc.Export()).
+// The history is captured on the first Read, not when Export is called.
+func (hc *HealthChecker) Export() io.Reader {
+	return &healthHistoryReader{hc: hc}
+}
+
+// healthHistoryReader encodes the history lazily on first Read.
+type healthHistoryReader struct {
+	hc  *HealthChecker
+	buf *bytes.Reader
+}
+
+func (r *healthHistoryReader) Read(p []byte) (int, error) {
+	if r.buf == nil {
+		r.hc.mu.RLock()
+		history := append([]HealthSnapshot(nil), r.hc.history...)
+		r.hc.mu.RUnlock()
+
+		var data bytes.Buffer
+		enc := json.NewEncoder(&data)
+		for _, snapshot := range history {
+			if err := enc.Encode(snapshot); err != nil {
+				return 0, err
+			}
+		}
+		r.buf = bytes.NewReader(data.Bytes())
+	}
+	return r.buf.Read(p)
+}
+
 // run runs the health check loop
 func (hc *HealthChecker) run(ctx context.Context) {
 	hc.performHealthCheck(ctx)
@@ -278,31 +1189,112 @@ func (hc *HealthChecker) run(ctx context.Context) {
 // When ConnectionManager has NameServer addrs, health is based on actual TCP probe (IsConnected).
 // Otherwise falls back to error-count heuristic.
 func (hc *HealthChecker) performHealthCheck(ctx context.Context) {
+	start := time.Now()
+	checkCtx := ctx
+	if timeout := hc.CheckTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		checkCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var probeErr error
 	if hc.connMgr != nil {
-		if err := hc.connMgr.checkConnectionContext(ctx); err != nil {
-			log.Debug("RocketMQ health checker connection probe failed", "error", err)
+		if probeErr = hc.connMgr.checkConnectionContext(checkCtx); probeErr != nil {
+			log.Debug("RocketMQ health checker connection probe failed", "error", probeErr)
 		}
 	}
 
+	// Run named checks outside the lock; they may block on I/O.
+	hc.mu.RLock()
+	checks := make(map[string]HealthCheckFunc, len(hc.checks))
+	for name, check := range hc.checks {
+		checks[name] = check
+	}
+	hc.mu.RUnlock()
+
+	checkErrs := make(map[string]error, len(checks))
+	for name, check := range checks {
+		checkErrs[name] = check(checkCtx)
+	}
+
 	hc.mu.Lock()
 	defer hc.mu.Unlock()
 
+	if hc.opts.timeoutBase > 0 {
+		timedOut := checkCtx.Err() != nil || isTimeoutError(probeErr)
+		hc.escalateTimeout(timedOut && ctx.Err() == nil)
+	}
 	hc.metrics.IncrementHealthCheckCount()
 	hc.lastCheck = time.Now()
+	hc.lastDuration = hc.lastCheck.Sub(start)
 	hc.metrics.UpdateLastHealthCheck()
 
-	if hc.connMgr != nil && len(hc.connMgr.nameServerAddrs) > 0 {
+	var failures []string
+	if hc.connMgr != nil && len(hc.connMgr.addrs()) > 0 {
 		hc.healthy = hc.connMgr.IsConnected()
+		if !hc.healthy {
+			failures = append(failures, "nameserver not connected")
+		}
 	} else if hc.errorCount < 5 {
 		hc.healthy = true
 	} else {
 		hc.healthy = false
+		failures = append(failures, fmt.Sprintf("error count %d", hc.errorCount))
+	}
+
+	names := make([]string, 0, len(checkErrs))
+	for name := range checkErrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := checkErrs[name]
+		hc.metrics.SetHealthCheckStatus(name, err == nil)
+		if err != nil {
+			hc.healthy = false
+			failures = append(failures, name+": "+err.Error())
+			log.Warn("Named health check failed", "check", name, "error", err)
+		}
+	}
+	hc.lastFailureReason = strings.Join(failures, "; ")
+
+	hc.withinSLA = true
+	if hc.healthy && hc.opts.slaMaxResponseTime > 0 && hc.lastDuration > hc.opts.slaMaxResponseTime {
+		hc.withinSLA = false
+		hc.metrics.IncrementHealthCheckSLAViolations()
+		log.Warn("Health check exceeded response time SLA", "duration", hc.lastDuration, "sla", hc.opts.slaMaxResponseTime)
 	}
 
 	if hc.healthy {
-		hc.metrics.SetHealthy(true)
+		hc.consecutiveSuccesses++
+		hc.consecutiveFailures = 0
+		if hc.healthySince.IsZero() {
+			hc.healthySince = hc.lastCheck
+		}
 	} else {
-		hc.metrics.SetHealthy(false)
+		hc.consecutiveFailures++
+		hc.consecutiveSuccesses = 0
+		hc.healthySince = time.Time{}
+	}
+
+	snapshot := HealthSnapshot{Healthy: hc.healthy, ErrorCount: hc.errorCount, At: hc.lastCheck}
+	if hc.opts.historySize > 0 {
+		hc.history = append(hc.history, snapshot)
+		if len(hc.history) > hc.opts.historySize {
+			hc.history = hc.history[len(hc.history)-hc.opts.historySize:]
+		}
+	}
+	for _, ch := range hc.watchers {
+		select {
+		case ch <- snapshot:
+		default:
+		}
+	}
+
+	// Publish the gauge as IsHealthy reports it, so a recovering checker
+	// stays unhealthy until RequireMinHealthyDuration has passed.
+	hc.metrics.SetHealthy(hc.isHealthyLocked())
+	if !hc.healthy {
 		hc.metrics.IncrementHealthCheckErrors()
 		log.Warn("Health check failed", "errorCount", hc.errorCount, "connected", hc.connMgr != nil && hc.connMgr.IsConnected())
 	}
@@ -0,0 +1,821 @@
+package rocketmq
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// pipeDialFunc returns a DialFunc that hands out in-memory connections and
+// records the addresses it was asked to dial.
+func pipeDialFunc(dialed *[]string) DialFunc {
+	return func(_ context.Context, _, addr string) (net.Conn, error) {
+		*dialed = append(*dialed, addr)
+		client, server := net.Pipe()
+		_ = server.Close()
+		return client, nil
+	}
+}
+
+func TestConnectionManagerWithDialFunc(t *testing.T) {
+	var dialed []string
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876"}, WithDialFunc(pipeDialFunc(&dialed)))
+
+	if err := cm.checkConnectionContext(context.Background()); err != nil {
+		t.Fatalf("checkConnectionContext failed: %v", err)
+	}
+	if !cm.IsConnected() {
+		t.Fatal("expected connection manager to be connected")
+	}
+	if len(dialed) != 1 || dialed[0] != "ns-1:9876" {
+		t.Fatalf("unexpected dialed addresses: %v", dialed)
+	}
+}
+
+func TestConnectionManagerWithFailingDialFunc(t *testing.T) {
+	dialErr := errors.New("dial refused")
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876", "ns-2:9876"}, WithDialFunc(
+		func(context.Context, string, string) (net.Conn, error) {
+			return nil, dialErr
+		},
+	))
+
+	err := cm.checkConnectionContext(context.Background())
+	if !errors.Is(err, dialErr) {
+		t.Fatalf("expected dial error, got %v", err)
+	}
+	if cm.IsConnected() {
+		t.Fatal("expected connection manager to be disconnected")
+	}
+}
+
+func TestConnectionManagerCheckpointRoundTrip(t *testing.T) {
+	var dialed []string
+	src := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876", "ns-2:9876"}, WithDialFunc(pipeDialFunc(&dialed)))
+	if err := src.checkConnectionContext(context.Background()); err != nil {
+		t.Fatalf("checkConnectionContext failed: %v", err)
+	}
+
+	data, err := json.Marshal(src.Checkpoint())
+	if err != nil {
+		t.Fatalf("marshal checkpoint failed: %v", err)
+	}
+	var cp ConnectionCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		t.Fatalf("unmarshal checkpoint failed: %v", err)
+	}
+
+	dst := NewConnectionManager(newIsolatedMetrics(), nil)
+	dst.RestoreFromCheckpoint(cp)
+
+	if !dst.IsConnected() {
+		t.Fatal("expected restored manager to be connected")
+	}
+	restored := dst.Checkpoint()
+	if len(restored.NameServerAddrs) != 2 || restored.NameServerAddrs[0] != "ns-1:9876" || restored.NameServerAddrs[1] != "ns-2:9876" {
+		t.Fatalf("unexpected restored addresses: %v", restored.NameServerAddrs)
+	}
+
+	// addrs hands out a copy, so callers cannot alias the manager's slice.
+	dst.addrs()[0] = "ns-9:9876"
+	if got := dst.addrs(); got[0] != "ns-1:9876" {
+		t.Fatalf("expected addrs to return a copy, got %v", got)
+	}
+}
+
+func TestHealthCheckerNamedChecks(t *testing.T) {
+	metrics := newIsolatedMetrics()
+	hc := NewHealthChecker(metrics, nil)
+	hc.AddCheck("storage", func(context.Context) error { return nil })
+	hc.AddCheck("downstream", func(context.Context) error { return errors.New("unreachable") })
+
+	hc.performHealthCheck(context.Background())
+
+	if hc.IsHealthy() {
+		t.Fatal("expected failing named check to mark checker unhealthy")
+	}
+	for name, want := range map[string]float64{"storage": 1, "downstream": 0, aggregateHealthCheckName: 0} {
+		if got := testutil.ToFloat64(metrics.promHealthStatus.WithLabelValues(name)); got != want {
+			t.Fatalf("health_check_status{name=%q} = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestConnectionManagerWithCustomStopCh(t *testing.T) {
+	stopCh := make(chan struct{})
+	cm := NewConnectionManager(newIsolatedMetrics(), nil, WithCustomStopCh(stopCh))
+	if err := cm.StartWithContext(context.Background()); err != nil {
+		t.Fatalf("StartWithContext failed: %v", err)
+	}
+
+	close(stopCh)
+
+	waitForCondition(t, time.Second, 10*time.Millisecond, func() bool {
+		cm.mu.RLock()
+		defer cm.mu.RUnlock()
+		return cm.cancel == nil
+	})
+
+	if err := cm.StartWithContext(context.Background()); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("expected ErrConnectionClosed after external stop, got %v", err)
+	}
+}
+
+func TestHealthCheckerSLAViolation(t *testing.T) {
+	metrics := newIsolatedMetrics()
+	hc := NewHealthChecker(metrics, nil, WithHealthCheckSLA(time.Millisecond))
+	hc.AddCheck("slow", func(context.Context) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+
+	hc.performHealthCheck(context.Background())
+
+	if !hc.IsHealthy() {
+		t.Fatal("expected slow but passing check to stay healthy")
+	}
+	if hc.IsWithinSLA() {
+		t.Fatalf("expected SLA violation for check taking %v", hc.LastDuration())
+	}
+	if got := metrics.GetStats().HealthCheckSLAViolations; got != 1 {
+		t.Fatalf("expected 1 SLA violation, got %d", got)
+	}
+}
+
+func TestConnectionManagerSetNameServerAddrs(t *testing.T) {
+	var dialed []string
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876"}, WithDialFunc(pipeDialFunc(&dialed)))
+
+	if err := cm.SetNameServerAddrs([]string{"ns-2:9876", "10.0.0.3:9876"}); err != nil {
+		t.Fatalf("SetNameServerAddrs failed: %v", err)
+	}
+	if len(dialed) != 1 || dialed[0] != "ns-2:9876" {
+		t.Fatalf("expected immediate probe of the new address, dialed %v", dialed)
+	}
+	if !cm.IsConnected() {
+		t.Fatal("expected connection manager to be connected after update")
+	}
+
+	for _, addrs := range [][]string{nil, {"ns-2"}, {":9876"}, {"ns-2:0"}, {"ns-2:port"}} {
+		if err := cm.SetNameServerAddrs(addrs); err == nil {
+			t.Fatalf("expected error for invalid addresses %v", addrs)
+		}
+	}
+	if got := cm.addrs(); len(got) != 2 || got[0] != "ns-2:9876" {
+		t.Fatalf("invalid update must not replace addresses, got %v", got)
+	}
+}
+
+func TestConnectionManagerProbeAll(t *testing.T) {
+	dialErr := errors.New("dial refused")
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876", "ns-2:9876"}, WithDialFunc(
+		func(_ context.Context, _, addr string) (net.Conn, error) {
+			if addr == "ns-2:9876" {
+				return nil, dialErr
+			}
+			client, server := net.Pipe()
+			_ = server.Close()
+			return client, nil
+		},
+	))
+
+	results := cm.ProbeAll(context.Background())
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if r := results["ns-1:9876"]; !r.Success || r.Error != "" {
+		t.Fatalf("expected ns-1 probe to succeed, got %+v", r)
+	}
+	if r := results["ns-2:9876"]; r.Success || r.Error != dialErr.Error() {
+		t.Fatalf("expected ns-2 probe to fail with dial error, got %+v", r)
+	}
+	if cm.IsConnected() {
+		t.Fatal("ProbeAll should not change connection state")
+	}
+}
+
+func TestConnectionManagerIsConnecting(t *testing.T) {
+	release := make(chan struct{})
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876"}, WithDialFunc(
+		func(context.Context, string, string) (net.Conn, error) {
+			<-release
+			client, server := net.Pipe()
+			_ = server.Close()
+			return client, nil
+		},
+	))
+	cm.RestoreFromCheckpoint(ConnectionCheckpoint{NameServerAddrs: []string{"ns-1:9876"}, Connected: true})
+	if cm.IsConnecting() || !cm.IsConnected() {
+		t.Fatal("expected restored manager to be connected and idle")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cm.checkConnectionContext(context.Background())
+	}()
+	waitForCondition(t, time.Second, time.Millisecond, cm.IsConnecting)
+	if cm.IsConnected() {
+		t.Fatal("restored state should not count as connected while re-probing")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("checkConnectionContext failed: %v", err)
+	}
+	if cm.IsConnecting() || !cm.IsConnected() {
+		t.Fatal("expected connected and idle after a successful probe")
+	}
+}
+
+func TestHealthCheckerString(t *testing.T) {
+	var dialed []string
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876"}, WithDialFunc(pipeDialFunc(&dialed)))
+	hc := cm.healthChecker
+	hc.performHealthCheck(context.Background())
+	hc.performHealthCheck(context.Background())
+
+	want := "HealthChecker{healthy:true, errorCount:0, lastCheck:" + hc.GetLastCheck().UTC().Format(time.RFC3339) +
+		", consecutiveSuccesses:2, consecutiveFailures:0}"
+	if got := hc.String(); got != want {
+		t.Fatalf("unexpected String():\n got %s\nwant %s", got, want)
+	}
+	if got := cm.String(); got != "ConnectionManager{connected:true, connecting:false, nameServers:[ns-1:9876]}" {
+		t.Fatalf("unexpected String(): %s", got)
+	}
+}
+
+func TestConnectionManagerWatchHealthChecker(t *testing.T) {
+	var dialed []string
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876"},
+		WithDialFunc(pipeDialFunc(&dialed)), WithHealthCheckerOptions(WithHealthWatchBuffer(1)))
+	watch := cm.WatchHealthChecker()
+
+	cm.healthChecker.performHealthCheck(context.Background())
+	cm.healthChecker.performHealthCheck(context.Background())
+
+	snapshot := <-watch
+	if !snapshot.Healthy || snapshot.At.IsZero() {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+	select {
+	case extra := <-watch:
+		t.Fatalf("expected the second snapshot to be dropped, got %+v", extra)
+	default:
+	}
+
+	cm.Stop()
+	if _, ok := <-watch; ok {
+		t.Fatal("expected watch channel to be closed on stop")
+	}
+}
+
+func TestConnectionManagerInjectFault(t *testing.T) {
+	var dialed []string
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876"}, WithDialFunc(pipeDialFunc(&dialed)))
+
+	cm.InjectFault(FaultConnectFail, time.Hour)
+	if err := cm.checkConnectionContext(context.Background()); !errors.Is(err, ErrConnectionFailed) {
+		t.Fatalf("expected injected connect failure, got %v", err)
+	}
+
+	cm.InjectFault(FaultAlternateSuccess, time.Hour)
+	var outcomes []bool
+	for i := 0; i < 4; i++ {
+		outcomes = append(outcomes, cm.checkConnectionContext(context.Background()) == nil)
+	}
+	if outcomes[0] || !outcomes[1] || outcomes[2] || !outcomes[3] {
+		t.Fatalf("expected alternating failures, got %v", outcomes)
+	}
+
+	cm.InjectFault(FaultSlowProbe(20*time.Millisecond), time.Hour)
+	start := time.Now()
+	if err := cm.checkConnectionContext(context.Background()); err != nil {
+		t.Fatalf("slow probe failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("expected probe to be delayed, took %s", elapsed)
+	}
+
+	cm.InjectFault(FaultConnectFail, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if err := cm.checkConnectionContext(context.Background()); err != nil {
+		t.Fatalf("expected normal probing after the fault expired, got %v", err)
+	}
+}
+
+func TestHealthCheckerExport(t *testing.T) {
+	hc := NewHealthChecker(newIsolatedMetrics(), nil, WithHealthHistorySize(2))
+	export := hc.Export()
+
+	for i := 0; i < 3; i++ {
+		hc.performHealthCheck(context.Background())
+	}
+
+	// The reader was created before any check ran but reads at Read time.
+	data, err := io.ReadAll(export)
+	if err != nil {
+		t.Fatalf("read export failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 history lines, got %d: %q", len(lines), data)
+	}
+	var snapshot HealthSnapshot
+	if err := json.Unmarshal([]byte(lines[1]), &snapshot); err != nil {
+		t.Fatalf("unmarshal history line failed: %v", err)
+	}
+	if !snapshot.Healthy || !snapshot.At.Equal(hc.GetLastCheck()) {
+		t.Fatalf("unexpected last snapshot: %+v", snapshot)
+	}
+}
+
+func TestAllHealthyAndAnyHealthy(t *testing.T) {
+	connected := NewConnectionManager(newIsolatedMetrics(), nil)
+	connected.RestoreFromCheckpoint(ConnectionCheckpoint{Connected: true})
+	disconnected := NewConnectionManager(newIsolatedMetrics(), nil)
+
+	if !AllHealthy(connected) || AllHealthy(connected, disconnected) || AllHealthy(connected, nil) {
+		t.Fatal("AllHealthy should require every manager to be connected")
+	}
+	if !AnyHealthy(disconnected, connected) || AnyHealthy(disconnected, nil) || AnyHealthy() {
+		t.Fatal("AnyHealthy should require at least one connected manager")
+	}
+}
+
+func TestHealthCheckerClone(t *testing.T) {
+	hc := NewHealthChecker(newIsolatedMetrics(), nil, WithHealthCheckSLA(time.Hour), WithHealthHistorySize(5))
+	hc.AddCheck("downstream", func(context.Context) error { return errors.New("unreachable") })
+	hc.performHealthCheck(context.Background())
+
+	clone := hc.Clone()
+	if clone.opts != hc.opts {
+		t.Fatalf("expected cloned options %+v, got %+v", hc.opts, clone.opts)
+	}
+	if len(clone.history) != 0 || clone.consecutiveFailures != 0 || clone.IsHealthy() {
+		t.Fatalf("expected fresh state, got %s", clone)
+	}
+
+	clone.performHealthCheck(context.Background())
+	if clone.IsHealthy() {
+		t.Fatal("expected cloned named check to run and fail")
+	}
+	if len(hc.history) != 1 {
+		t.Fatalf("running the clone should not touch the original, history=%d", len(hc.history))
+	}
+}
+
+func TestConnectionManagerRunnableAndReadyz(t *testing.T) {
+	var dialed []string
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876"}, WithDialFunc(pipeDialFunc(&dialed)))
+	if err := cm.ReadyzCheck(nil); !errors.Is(err, ErrUnhealthy) {
+		t.Fatalf("expected ErrUnhealthy before start, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- cm.Runnable().Start(ctx)
+	}()
+	waitForCondition(t, time.Second, time.Millisecond, func() bool { return cm.ReadyzCheck(nil) == nil })
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runnable returned error: %v", err)
+	}
+}
+
+func TestHealthCheckerCheckAsync(t *testing.T) {
+	release := make(chan struct{})
+	hc := NewHealthChecker(newIsolatedMetrics(), nil)
+	hc.AddCheck("slow", func(context.Context) error {
+		<-release
+		return nil
+	})
+
+	results := make(chan error, 2)
+	hc.CheckAsync(func(_ bool, err error) { results <- err })
+	hc.CheckAsync(func(_ bool, err error) { results <- err })
+
+	if err := <-results; !errors.Is(err, ErrCheckInFlight) {
+		t.Fatalf("expected ErrCheckInFlight for the concurrent check, got %v", err)
+	}
+	close(release)
+	if err := <-results; err != nil {
+		t.Fatalf("expected the first check to pass, got %v", err)
+	}
+}
+
+func TestConnectionManagerTLSFingerprint(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	sum := sha256.Sum256(server.Certificate().Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+	addr := server.Listener.Addr().String()
+
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{addr},
+		WithTLSConfig(&tls.Config{RootCAs: roots}), WithTLSFingerprint(strings.ToUpper(fingerprint)))
+	if err := cm.checkConnectionContext(context.Background()); err != nil {
+		t.Fatalf("expected matching fingerprint to pass, got %v", err)
+	}
+
+	pinned := strings.Repeat("0", 64)
+	cm = NewConnectionManager(newIsolatedMetrics(), []string{addr},
+		WithTLSConfig(&tls.Config{RootCAs: roots}), WithTLSFingerprint(pinned))
+	err := cm.checkConnectionContext(context.Background())
+	var mismatch *ErrTLSFingerprintMismatch
+	if !errors.As(err, &mismatch) || mismatch.Expected != pinned || mismatch.Got != fingerprint {
+		t.Fatalf("expected ErrTLSFingerprintMismatch, got %v", err)
+	}
+}
+
+func TestHealthCheckerUnregister(t *testing.T) {
+	metrics := newIsolatedMetrics()
+	hc := NewHealthChecker(metrics, nil)
+	hc.AddCheck("database", func(context.Context) error { return errors.New("closed") })
+	hc.performHealthCheck(context.Background())
+
+	if err := hc.Unregister("database"); err != nil {
+		t.Fatalf("Unregister failed: %v", err)
+	}
+	if err := hc.Unregister("database"); !errors.Is(err, ErrCheckNotFound) {
+		t.Fatalf("expected ErrCheckNotFound, got %v", err)
+	}
+	if n := testutil.CollectAndCount(metrics.promHealthStatus); n != 1 {
+		t.Fatalf("expected only the aggregate status series, got %d series", n)
+	}
+
+	hc.performHealthCheck(context.Background())
+	if !hc.IsHealthy() {
+		t.Fatal("expected checker to be healthy once the failing check is removed")
+	}
+}
+
+func TestConnectionManagerMetricsSnapshot(t *testing.T) {
+	metrics := newIsolatedMetrics()
+	cm := NewConnectionManager(metrics, []string{"ns-1:9876", "ns-2:9876"}, WithDialFunc(
+		func(_ context.Context, _, addr string) (net.Conn, error) {
+			if addr == "ns-1:9876" {
+				return nil, errors.New("dial refused")
+			}
+			client, server := net.Pipe()
+			_ = server.Close()
+			return client, nil
+		},
+	))
+	metrics.IncrementProducerMessagesSent()
+
+	if snap := cm.MetricsSnapshot(); snap.CurrentState != ConnectionStateDisconnected || !snap.LastProbeAt.IsZero() {
+		t.Fatalf("unexpected snapshot before probing: %+v", snap)
+	}
+
+	if err := cm.checkConnectionContext(context.Background()); err != nil {
+		t.Fatalf("checkConnectionContext failed: %v", err)
+	}
+	cm.ForceReconnect()
+
+	snap := cm.MetricsSnapshot()
+	if snap.ProducerSent != 1 || snap.ReconnectionCount != 1 {
+		t.Fatalf("expected embedded stats, got %+v", snap.Stats)
+	}
+	if snap.CurrentState != ConnectionStateDisconnected || snap.ActiveNameServer != "ns-2:9876" ||
+		snap.LastProbeAt.IsZero() || snap.LastReconnectAt.Before(snap.LastProbeAt) {
+		t.Fatalf("unexpected connection state: %+v", snap)
+	}
+}
+
+func TestHealthCheckerRequireMinHealthyDuration(t *testing.T) {
+	metrics := newIsolatedMetrics()
+	hc := NewHealthChecker(metrics, nil, RequireMinHealthyDuration(50*time.Millisecond))
+	var failing atomic.Bool
+	hc.AddCheck("nameserver", func(context.Context) error {
+		if failing.Load() {
+			return errors.New("unreachable")
+		}
+		return nil
+	})
+
+	hc.performHealthCheck(context.Background())
+	if hc.IsHealthy() {
+		t.Fatal("expected checker to stay unhealthy before the minimum healthy duration")
+	}
+	if metrics.GetStats().IsHealthy || strings.Contains(hc.String(), "healthy:true") {
+		t.Fatalf("expected gauge and String to agree with IsHealthy, got %v and %s", metrics.GetStats().IsHealthy, hc)
+	}
+	waitForCondition(t, time.Second, 10*time.Millisecond, hc.IsHealthy)
+	hc.performHealthCheck(context.Background())
+	if !metrics.GetStats().IsHealthy || !strings.Contains(hc.String(), "healthy:true") {
+		t.Fatalf("expected gauge and String to report healthy once the duration passed, got %v and %s", metrics.GetStats().IsHealthy, hc)
+	}
+
+	// A single failure restarts the streak.
+	failing.Store(true)
+	hc.performHealthCheck(context.Background())
+	failing.Store(false)
+	hc.performHealthCheck(context.Background())
+	if hc.IsHealthy() {
+		t.Fatal("expected recovery after a failure to wait out the minimum healthy duration again")
+	}
+}
+
+func TestConnectionManagerAddressLatencyIndex(t *testing.T) {
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876", "ns-2:9876"}, WithDialFunc(
+		func(_ context.Context, _, addr string) (net.Conn, error) {
+			if addr == "ns-2:9876" {
+				time.Sleep(20 * time.Millisecond)
+			}
+			client, server := net.Pipe()
+			_ = server.Close()
+			return client, nil
+		},
+	))
+
+	if index := cm.AddressLatencyIndex(); len(index) != 0 {
+		t.Fatalf("expected empty index before probing, got %v", index)
+	}
+	cm.ProbeAll(context.Background())
+	index := cm.AddressLatencyIndex()
+	if len(index) != 2 || index[0].Addr != "ns-1:9876" || index[1].Addr != "ns-2:9876" || index[0].Latency >= index[1].Latency {
+		t.Fatalf("expected ns-1 before the slower ns-2, got %v", index)
+	}
+
+	if err := cm.SetNameServerAddrs([]string{"ns-2:9876"}); err != nil {
+		t.Fatalf("SetNameServerAddrs failed: %v", err)
+	}
+	if index := cm.AddressLatencyIndex(); len(index) != 1 || index[0].Addr != "ns-2:9876" || index[0].Latency == 0 {
+		t.Fatalf("expected only ns-2 after address update, got %v", index)
+	}
+}
+
+func TestConnectionManagerNameServerVersion(t *testing.T) {
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876", "ns-2:9876"}, WithDialFunc(
+		func(_ context.Context, _, addr string) (net.Conn, error) {
+			if addr == "ns-2:9876" {
+				return nil, errors.New("dial refused")
+			}
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				request, err := readRemotingCommand(server)
+				if err != nil || request.Code != reqGetNamesrvConfig {
+					return
+				}
+				_ = writeRemotingCommand(server, remotingHeader{Code: 0, Language: "JAVA", Version: 433, Opaque: request.Opaque, Flag: remotingResponseFlag})
+			}()
+			return client, nil
+		},
+	))
+
+	versions, err := cm.NameServerVersion(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "ns-2:9876") {
+		t.Fatalf("expected error naming the unreachable server, got %v", err)
+	}
+	if len(versions) != 1 || versions["ns-1:9876"] != "433" {
+		t.Fatalf("unexpected versions: %v", versions)
+	}
+}
+
+func TestHealthCheckerTimeoutEscalation(t *testing.T) {
+	hc := NewHealthChecker(newIsolatedMetrics(), nil, WithTimeoutEscalation(10*time.Millisecond, 30*time.Millisecond, 2))
+	var slow atomic.Bool
+	hc.AddCheck("nameserver", func(ctx context.Context) error {
+		if slow.Load() {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+
+	slow.Store(true)
+	for _, want := range []time.Duration{20 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond} {
+		hc.performHealthCheck(context.Background())
+		if got := hc.CheckTimeout(); got != want {
+			t.Fatalf("after timeout: check timeout = %v, want %v", got, want)
+		}
+	}
+
+	slow.Store(false)
+	hc.performHealthCheck(context.Background())
+	if got := hc.CheckTimeout(); got != 30*time.Millisecond {
+		t.Fatalf("expected timeout to stay escalated after one success, got %v", got)
+	}
+	hc.performHealthCheck(context.Background())
+	if got := hc.CheckTimeout(); got != 10*time.Millisecond {
+		t.Fatalf("expected timeout reset to base after two successes, got %v", got)
+	}
+}
+
+func TestHealthCheckerEscalatesProbeTimeout(t *testing.T) {
+	// The NameServer accepts nothing until the context expires; each probe
+	// reports how long it was allowed to wait.
+	budgets := make(chan time.Duration, 8)
+	hang := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		deadline, _ := ctx.Deadline()
+		budgets <- time.Until(deadline)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876"},
+		WithDialFunc(hang),
+		WithHealthCheckerOptions(WithTimeoutEscalation(20*time.Millisecond, 80*time.Millisecond, 2)))
+
+	for _, want := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond} {
+		cm.healthChecker.performHealthCheck(context.Background())
+		if budget := <-budgets; budget > want || budget < want/2 {
+			t.Fatalf("probe budget = %v, want about %v", budget, want)
+		}
+		if got, next := cm.healthChecker.CheckTimeout(), min(2*want, 80*time.Millisecond); got != next {
+			t.Fatalf("after probe timeout: check timeout = %v, want %v", got, next)
+		}
+	}
+
+	// A dialer that gives up on its own deadline still counts as a timeout.
+	cm = NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876"},
+		WithDialFunc(func(context.Context, string, string) (net.Conn, error) {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+		}),
+		WithHealthCheckerOptions(WithTimeoutEscalation(20*time.Millisecond, 80*time.Millisecond, 2)))
+	cm.healthChecker.performHealthCheck(context.Background())
+	if got := cm.healthChecker.CheckTimeout(); got != 40*time.Millisecond {
+		t.Fatalf("expected dial timeout to escalate, got %v", got)
+	}
+}
+
+func TestConnectionManagerSetMetrics(t *testing.T) {
+	startup := newIsolatedMetrics()
+	cm := NewConnectionManager(startup, nil)
+	cm.ForceReconnect()
+
+	production := newIsolatedMetrics()
+	cm.SetMetrics(production)
+	cm.ForceReconnect()
+	cm.healthChecker.performHealthCheck(context.Background())
+
+	if got := startup.GetStats(); got.ReconnectionCount != 1 || got.HealthCheckCount != 0 {
+		t.Fatalf("expected startup metrics to keep only the pre-swap reconnect, got %+v", got)
+	}
+	if got := production.GetStats(); got.ReconnectionCount != 1 || got.HealthCheckCount != 1 {
+		t.Fatalf("expected post-swap activity on the new metrics, got %+v", got)
+	}
+	if got := cm.MetricsSnapshot().ReconnectionCount; got != 1 {
+		t.Fatalf("expected snapshot to read the new metrics, got %d reconnections", got)
+	}
+}
+
+func TestHealthCheckerMarshalJSON(t *testing.T) {
+	hc := NewHealthChecker(newIsolatedMetrics(), nil)
+	var failing atomic.Bool
+	failing.Store(true)
+	hc.AddCheck("database", func(context.Context) error {
+		if failing.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	hc.performHealthCheck(context.Background())
+	var got map[string]any
+	data, err := json.Marshal(hc)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if got["healthy"] != false || got["consecutiveFailures"] != float64(1) || got["lastFailureReason"] != "database: connection refused" {
+		t.Fatalf("unexpected JSON for failing checker: %s", data)
+	}
+	if _, ok := got["lastCheck"].(string); !ok {
+		t.Fatalf("expected lastCheck timestamp, got %s", data)
+	}
+
+	failing.Store(false)
+	hc.performHealthCheck(context.Background())
+	data, _ = json.Marshal(hc)
+	if !strings.Contains(string(data), `"healthy":true`) || !strings.Contains(string(data), `"lastFailureReason":""`) {
+		t.Fatalf("unexpected JSON for recovered checker: %s", data)
+	}
+}
+
+func TestConnectionManagerWithDialerOptions(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	var controlled atomic.Int32
+	dialer := net.Dialer{
+		LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		Control: func(_, _ string, _ syscall.RawConn) error {
+			controlled.Add(1)
+			return nil
+		},
+	}
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{ln.Addr().String()}, WithDialerOptions(dialer))
+
+	if err := cm.checkConnectionContext(context.Background()); err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	if controlled.Load() != 1 {
+		t.Fatalf("expected the probe to use the configured dialer, Control ran %d times", controlled.Load())
+	}
+}
+
+func TestHealthCheckerScheduledCheck(t *testing.T) {
+	hc := NewHealthChecker(newIsolatedMetrics(), nil)
+	var checkedAt atomic.Int64
+	hc.AddCheck("batch-inputs", func(context.Context) error {
+		checkedAt.Store(time.Now().UnixNano())
+		return nil
+	})
+
+	at := time.Now().Add(30 * time.Millisecond)
+	if healthy := <-hc.ScheduledCheck(at); !healthy {
+		t.Fatal("expected scheduled check to report healthy")
+	}
+	if ran := time.Unix(0, checkedAt.Load()); ran.Before(at) {
+		t.Fatalf("check ran at %v, before the scheduled time %v", ran, at)
+	}
+
+	select {
+	case healthy, ok := <-hc.ScheduledCheck(time.Now().Add(-time.Hour)):
+		if !ok || !healthy {
+			t.Fatalf("expected an immediate healthy result, got %t (open %t)", healthy, ok)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a past schedule to fire immediately")
+	}
+
+	// Cancelling the context drops the pending check.
+	ctx, cancel := context.WithCancel(context.Background())
+	pending := hc.ScheduledCheckWithContext(ctx, time.Now().Add(time.Hour))
+	cancel()
+	select {
+	case _, ok := <-pending:
+		if ok {
+			t.Fatal("expected a cancelled check to close without a result")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected cancel to close the channel")
+	}
+
+	// A checker stopped before the scheduled time skips the check.
+	checkedAt.Store(0)
+	pending = hc.ScheduledCheck(time.Now().Add(30 * time.Millisecond))
+	hc.Stop()
+	if _, ok := <-pending; ok || checkedAt.Load() != 0 {
+		t.Fatalf("expected no check on a stopped checker (result sent %t)", ok)
+	}
+}
+
+func TestConnectionManagerIsReadyForTraffic(t *testing.T) {
+	var dialed []string
+	cm := NewConnectionManager(newIsolatedMetrics(), []string{"ns-1:9876"}, WithDialFunc(pipeDialFunc(&dialed)))
+	var warmedUp atomic.Bool
+	cm.AddReadinessGate("cache", warmedUp.Load)
+
+	if cm.IsReadyForTraffic() {
+		t.Fatal("expected not ready before the first health check")
+	}
+	cm.healthChecker.performHealthCheck(context.Background())
+	if !cm.IsConnected() || !cm.healthChecker.IsHealthy() {
+		t.Fatal("expected the health check to connect the manager")
+	}
+	if cm.IsReadyForTraffic() {
+		t.Fatal("expected not ready while a readiness gate is closed")
+	}
+
+	warmedUp.Store(true)
+	if !cm.IsReadyForTraffic() {
+		t.Fatal("expected ready once connected, healthy and all gates are open")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/consumer"
 	"github.com/apache/rocketmq-client-go/v2/primitive"
 	"github.com/go-lynx/lynx/plugins"
 )
@@ -23,9 +24,30 @@ type Producer interface {
 	// SendMessageAsync sends a message asynchronously
 	SendMessageAsync(ctx context.Context, topic string, body []byte) error
 
+	// SendContext sends a prepared message through the default producer
+	SendContext(ctx context.Context, msg *primitive.Message) (*primitive.SendResult, error)
+
+	// SendAt sends a prepared message for delivery at a future time
+	SendAt(ctx context.Context, msg *primitive.Message, deliverAt time.Time) (*primitive.SendResult, error)
+
+	// SendWithHeaders merges headers into a message's properties and sends it
+	SendWithHeaders(ctx context.Context, msg *primitive.Message, headers map[string]string) (*primitive.SendResult, error)
+
+	// SendBatchStream sends batches read from a channel, reporting each result
+	SendBatchStream(ctx context.Context, batches <-chan []*primitive.Message) <-chan BatchSendResult
+
 	// SendMessageWith sends a message by producer instance name
 	SendMessageWith(ctx context.Context, producerName, topic string, body []byte) error
 
+	// ConfigureProducer applies options to a producer instance
+	ConfigureProducer(name string, opts ...ProducerOption)
+
+	// PendingCount returns the number of in-flight async sends of a producer
+	PendingCount(producerName string) int
+
+	// TopicMetrics returns the default producer's send counters for a topic
+	TopicMetrics(topic string) TopicMetrics
+
 	// GetProducer gets the underlying producer client
 	GetProducer(name string) (rocketmq.Producer, error)
 
@@ -36,10 +58,28 @@ type Producer interface {
 // Consumer RocketMQ consumer interface
 type Consumer interface {
 	// Subscribe subscribes to topics and sets message handler
-	Subscribe(ctx context.Context, topics []string, handler MessageHandler) error
+	Subscribe(ctx context.Context, topics []string, handler MessageHandler, opts ...ConsumerOption) error
 
 	// SubscribeWith subscribes by consumer instance name
-	SubscribeWith(ctx context.Context, consumerName string, topics []string, handler MessageHandler) error
+	SubscribeWith(ctx context.Context, consumerName string, topics []string, handler MessageHandler, opts ...ConsumerOption) error
+
+	// AckManually commits the outcome of a message consumed WithManualAck
+	AckManually(msg *primitive.MessageExt, outcome consumer.ConsumeResult) error
+
+	// Topics returns the topics a consumer instance is subscribed to
+	Topics(consumerName string) []string
+
+	// MaxRetries returns the redelivery limit of a consumer instance
+	MaxRetries(consumerName string) int
+
+	// RetryExhaustedCount returns how many messages exceeded MaxRetries
+	RetryExhaustedCount(consumerName string) int64
+
+	// MessageRateWindow returns a consumer's recent processing rate
+	MessageRateWindow(consumerName string, d time.Duration) float64
+
+	// ObserveProcessingTime registers an observer of handler durations
+	ObserveProcessingTime(fn func(topic string, d time.Duration))
 
 	// GetConsumer gets the underlying consumer client
 	GetConsumer(name string) (rocketmq.PushConsumer, error)
@@ -56,6 +96,8 @@ type ClientInterface interface {
 	InitializeResources(rt plugins.Runtime) error
 	StartupTasks() error
 	ShutdownTasks() error
+	GracefulStop(ctx context.Context) error
+	PendingCallbackCount() int
 	GetMetrics() *Metrics
 }
 
@@ -0,0 +1,45 @@
+// Package msgcopy copies RocketMQ messages. Message holds a mutex, so the
+// fields are copied one by one rather than by value.
+package msgcopy
+
+import "github.com/apache/rocketmq-client-go/v2/primitive"
+
+// Message returns a copy of msg sharing its body and properties.
+func Message(msg *primitive.Message) *primitive.Message {
+	clone := &primitive.Message{}
+	copyFields(clone, msg)
+	return clone
+}
+
+// Ext returns a copy of msg sharing its body and properties.
+func Ext(msg *primitive.MessageExt) *primitive.MessageExt {
+	clone := &primitive.MessageExt{
+		MsgId:                     msg.MsgId,
+		OffsetMsgId:               msg.OffsetMsgId,
+		StoreSize:                 msg.StoreSize,
+		QueueOffset:               msg.QueueOffset,
+		SysFlag:                   msg.SysFlag,
+		BornTimestamp:             msg.BornTimestamp,
+		BornHost:                  msg.BornHost,
+		StoreTimestamp:            msg.StoreTimestamp,
+		StoreHost:                 msg.StoreHost,
+		CommitLogOffset:           msg.CommitLogOffset,
+		BodyCRC:                   msg.BodyCRC,
+		ReconsumeTimes:            msg.ReconsumeTimes,
+		PreparedTransactionOffset: msg.PreparedTransactionOffset,
+	}
+	copyFields(&clone.Message, &msg.Message)
+	return clone
+}
+
+func copyFields(dst, src *primitive.Message) {
+	dst.Topic = src.Topic
+	dst.Body = src.Body
+	dst.CompressedBody = src.CompressedBody
+	dst.Flag = src.Flag
+	dst.TransactionId = src.TransactionId
+	dst.Batch = src.Batch
+	dst.Compress = src.Compress
+	dst.Queue = src.Queue
+	dst.WithProperties(src.GetProperties())
+}
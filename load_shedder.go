@@ -0,0 +1,149 @@
+package rocketmq
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+// loadShedWindow is the number of recent message priorities DropLowest ranks
+// new messages against.
+const loadShedWindow = 256
+
+// LoadSheddingPolicy decides which messages a LoadShedder drops. Admit is
+// called for every message, so the policy can learn the traffic mix;
+// overloaded reports whether the producer is currently above the shedding
+// threshold.
+type LoadSheddingPolicy interface {
+	Admit(msg *primitive.Message, overloaded bool) bool
+}
+
+// dropLowestPolicy is the LoadSheddingPolicy returned by DropLowest.
+type dropLowestPolicy struct {
+	priorityFn   func(msg *primitive.Message) int
+	dropFraction float64
+
+	mu     sync.Mutex
+	window []int
+	next   int
+}
+
+// DropLowest sheds, while overloaded, the messages whose priority ranks in
+// the lowest dropFraction of the last loadShedWindow messages; higher
+// priorityFn values are more important. When the cut falls among messages of
+// equal priority, each of them is shed with the probability that keeps the
+// overall drop rate at dropFraction, so uniform traffic, including a nil
+// priorityFn, loses dropFraction of its messages.
+func DropLowest(priorityFn func(msg *primitive.Message) int, dropFraction float64) LoadSheddingPolicy {
+	if priorityFn == nil {
+		priorityFn = func(*primitive.Message) int { return 0 }
+	}
+	return &dropLowestPolicy{priorityFn: priorityFn, dropFraction: dropFraction}
+}
+
+func (p *dropLowestPolicy) Admit(msg *primitive.Message, overloaded bool) bool {
+	priority := p.priorityFn(msg)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.window) < loadShedWindow {
+		p.window = append(p.window, priority)
+	} else {
+		p.window[p.next] = priority
+		p.next = (p.next + 1) % loadShedWindow
+	}
+	if !overloaded {
+		return true
+	}
+
+	// Shares of the window ranked strictly below and equal to priority.
+	var below, equal int
+	for _, v := range p.window {
+		if v < priority {
+			below++
+		} else if v == priority {
+			equal++
+		}
+	}
+	n := float64(len(p.window))
+	lower, tied := float64(below)/n, float64(equal)/n
+	switch {
+	case p.dropFraction <= lower:
+		return true
+	case p.dropFraction >= lower+tied:
+		return false
+	default:
+		return rand.Float64() >= (p.dropFraction-lower)/tied
+	}
+}
+
+// LoadShedder sends messages asynchronously through a producer instance and,
+// once the instance's in-flight async sends reach a threshold, drops the
+// messages its LoadSheddingPolicy rejects instead of letting every sender
+// queue up behind a slow broker. Without a policy it never sheds.
+type LoadShedder struct {
+	client       *Client
+	producerName string
+	policy       LoadSheddingPolicy
+	threshold    int
+}
+
+// LoadShedderOption configures a LoadShedder.
+type LoadShedderOption func(*LoadShedder)
+
+// WithLoadShedding sets the policy that picks the messages to drop.
+func WithLoadShedding(policy LoadSheddingPolicy) LoadShedderOption {
+	return func(s *LoadShedder) {
+		s.policy = policy
+	}
+}
+
+// WithShedThreshold sets the number of in-flight async sends at which the
+// producer counts as overloaded. It defaults to the producer's
+// WithMaxPendingMessages limit, so shedding starts where sends would block.
+func WithShedThreshold(n int) LoadShedderOption {
+	return func(s *LoadShedder) {
+		s.threshold = n
+	}
+}
+
+// NewLoadShedder wraps the async send path of the named producer instance. An
+// empty name uses the default producer.
+func NewLoadShedder(client *Client, producerName string, opts ...LoadShedderOption) *LoadShedder {
+	s := &LoadShedder{
+		client:       client,
+		producerName: producerName,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// SendAsync sends msg asynchronously and passes the delivery outcome to
+// onResult, which may be nil. It returns ErrShedded without sending when the
+// policy drops msg.
+func (s *LoadShedder) SendAsync(ctx context.Context, msg *primitive.Message, onResult func(*primitive.SendResult, error)) error {
+	if msg == nil {
+		return ErrInvalidMessage
+	}
+	if s.policy != nil && !s.policy.Admit(msg, s.overloaded()) {
+		s.client.producerMetrics(s.producerName).IncrementLoadShed()
+		return WrapError(ErrShedded, "topic "+msg.Topic)
+	}
+	return s.client.sendAsync(ctx, s.producerName, msg, onResult)
+}
+
+// overloaded reports whether the producer's in-flight async sends have
+// reached the threshold.
+func (s *LoadShedder) overloaded() bool {
+	threshold := s.threshold
+	if threshold <= 0 {
+		threshold = s.client.producerOptions(s.producerName).maxPendingMessages
+	}
+	return threshold > 0 && s.client.PendingCount(s.producerName) >= threshold
+}
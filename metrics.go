@@ -7,11 +7,14 @@ package rocketmq
 
 import (
 	"errors"
+	"fmt"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 // Metrics records RocketMQ operational counters and latency histograms and
@@ -32,21 +35,130 @@ type Metrics struct {
 	reconnectionCount int64
 	lastReconnectTime time.Time
 
-	healthCheckCount  int64
-	healthCheckErrors int64
-	lastHealthCheck   time.Time
-	isHealthy         int32
-
-	// Prometheus instruments
-	promProducerSent     prometheus.Counter
-	promProducerFailed   prometheus.Counter
-	promProducerLatency  prometheus.Histogram
-	promConsumerReceived prometheus.Counter
-	promConsumerFailed   prometheus.Counter
-	promConsumerLatency  prometheus.Histogram
+	healthCheckCount         int64
+	healthCheckErrors        int64
+	healthCheckSLAViolations int64
+	lastHealthCheck          time.Time
+	isHealthy                int32
+
+	loadShedCount      int64
+	topicMismatchCount int64
+
+	fingerprintCacheHitCount  int64
+	fingerprintCacheMissCount int64
+
+	// Prometheus instruments; producer and consumer series are labelled by
+	// instance (see WithNamedInstance and WithNamedConsumerInstance)
+	promProducerSent     *prometheus.CounterVec
+	promProducerFailed   *prometheus.CounterVec
+	promProducerLatency  *prometheus.HistogramVec
+	promConsumerReceived *prometheus.CounterVec
+	promConsumerFailed   *prometheus.CounterVec
+	promConsumerLatency  *prometheus.HistogramVec
 	promConnErrors       prometheus.Counter
 	promReconnections    prometheus.Counter
 	promHealthErrors     prometheus.Counter
+	promHealthStatus     *prometheus.GaugeVec
+	promHealthSLA        prometheus.Counter
+	promLoadShed         *prometheus.CounterVec
+	promTopicMismatch    *prometheus.CounterVec
+	promFingerprintHit   *prometheus.CounterVec
+	promFingerprintMiss  *prometheus.CounterVec
+}
+
+// aggregateHealthCheckName is the health_check_status label value that
+// mirrors HealthChecker.IsHealthy across all checks.
+const aggregateHealthCheckName = "aggregate"
+
+// Histogram names accepted by WithHistogramBuckets (subsystem_name, without
+// the lynx_rocketmq namespace).
+const (
+	HistogramProducerSendDuration    = "producer_send_duration_seconds"
+	HistogramConsumerProcessDuration = "consumer_process_duration_seconds"
+)
+
+// MetricsOption configures a Metrics instance at construction time.
+type MetricsOption func(*metricsOptions)
+
+type metricsOptions struct {
+	buckets map[string][]float64
+}
+
+// WithHistogramBuckets overrides the bucket boundaries of the named histogram
+// (see the Histogram* constants); other histograms keep prometheus.DefBuckets.
+// Buckets must be non-empty and strictly ascending.
+func WithHistogramBuckets(metricName string, buckets []float64) MetricsOption {
+	return func(o *metricsOptions) {
+		o.buckets[metricName] = slices.Clone(buckets)
+	}
+}
+
+// validate rejects bucket overrides for unknown histograms and invalid
+// bucket boundaries with ErrInvalidConfiguration.
+func (o *metricsOptions) validate() error {
+	for name, buckets := range o.buckets {
+		if name != HistogramProducerSendDuration && name != HistogramConsumerProcessDuration {
+			return WrapError(ErrInvalidConfiguration, "unknown histogram "+name)
+		}
+		if err := validateHistogramBuckets(buckets); err != nil {
+			return WrapError(ErrInvalidConfiguration, name+": "+err.Error())
+		}
+	}
+	return nil
+}
+
+// validateHistogramBuckets checks that buckets are non-empty and strictly ascending.
+func validateHistogramBuckets(buckets []float64) error {
+	if len(buckets) == 0 {
+		return errors.New("buckets must not be empty")
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return fmt.Errorf("buckets must be sorted ascending: %v <= %v at index %d", buckets[i], buckets[i-1], i)
+		}
+	}
+	return nil
+}
+
+// bucketsFor returns the configured buckets for name, or prometheus.DefBuckets.
+func (o *metricsOptions) bucketsFor(name string) []float64 {
+	if buckets, ok := o.buckets[name]; ok {
+		return buckets
+	}
+	return prometheus.DefBuckets
+}
+
+// defaultMetricsOptions are the options set by SetMetricsOptions.
+var defaultMetricsOptions struct {
+	sync.Mutex
+	opts []MetricsOption
+}
+
+// SetMetricsOptions sets the options, e.g. WithHistogramBuckets, of the
+// metrics of clients created afterwards, including the client the plugin
+// factory creates; call it before the lynx application boots. It returns an
+// ErrInvalidConfiguration error for invalid options, or when a histogram is
+// already registered with other buckets because a client was created first.
+func SetMetricsOptions(opts ...MetricsOption) error {
+	if _, err := NewMetricsWithOptions(opts...); err != nil {
+		return err
+	}
+	defaultMetricsOptions.Lock()
+	defaultMetricsOptions.opts = slices.Clone(opts)
+	defaultMetricsOptions.Unlock()
+	return nil
+}
+
+// newDefaultMetrics builds the metrics of a new client from the options set
+// by SetMetricsOptions.
+func newDefaultMetrics() *Metrics {
+	defaultMetricsOptions.Lock()
+	opts := defaultMetricsOptions.opts
+	defaultMetricsOptions.Unlock()
+	if m, err := NewMetricsWithOptions(opts...); err == nil {
+		return m
+	}
+	return NewMetrics()
 }
 
 // NewMetrics creates a Metrics instance and registers Prometheus instruments
@@ -54,54 +166,73 @@ type Metrics struct {
 // plugin is instantiated multiple times in a test suite) are silently ignored:
 // the already-registered collector is reused.
 func NewMetrics() *Metrics {
-	return newMetricsWithRegisterer(prometheus.DefaultRegisterer)
+	m, _ := newMetricsWithRegisterer(prometheus.DefaultRegisterer)
+	return m
+}
+
+// NewMetricsWithOptions is NewMetrics configured by opts. Since an
+// already-registered collector is reused, it returns an
+// ErrInvalidConfiguration error when a histogram is already registered with
+// buckets other than the requested ones, as well as for invalid options.
+func NewMetricsWithOptions(opts ...MetricsOption) (*Metrics, error) {
+	return newMetricsWithRegisterer(prometheus.DefaultRegisterer, opts...)
 }
 
 // newMetricsWithRegisterer is the internal constructor used by tests to supply
 // an isolated registry and avoid duplicate-registration conflicts.
-func newMetricsWithRegisterer(reg prometheus.Registerer) *Metrics {
+func newMetricsWithRegisterer(reg prometheus.Registerer, opts ...MetricsOption) (*Metrics, error) {
+	options := metricsOptions{buckets: make(map[string][]float64)}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
 	m := &Metrics{
 		lastHealthCheck: time.Now(),
 	}
 
-	m.promProducerSent = mustOrExisting[prometheus.Counter](reg, prometheus.NewCounter(prometheus.CounterOpts{
+	m.promProducerSent = mustOrExisting[*prometheus.CounterVec](reg, prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "lynx_rocketmq",
 		Subsystem: "producer",
 		Name:      "messages_sent_total",
 		Help:      "Total number of messages successfully sent by the producer.",
-	}))
-	m.promProducerFailed = mustOrExisting[prometheus.Counter](reg, prometheus.NewCounter(prometheus.CounterOpts{
+	}, []string{"instance"}))
+	m.promProducerFailed = mustOrExisting[*prometheus.CounterVec](reg, prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "lynx_rocketmq",
 		Subsystem: "producer",
 		Name:      "messages_failed_total",
 		Help:      "Total number of messages that failed to be sent by the producer.",
-	}))
-	m.promProducerLatency = mustOrExisting[prometheus.Histogram](reg, prometheus.NewHistogram(prometheus.HistogramOpts{
+	}, []string{"instance"}))
+	m.promProducerLatency = mustOrExisting[*prometheus.HistogramVec](reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: "lynx_rocketmq",
 		Subsystem: "producer",
 		Name:      "send_duration_seconds",
 		Help:      "Histogram of producer send latency in seconds.",
-		Buckets:   prometheus.DefBuckets,
-	}))
-	m.promConsumerReceived = mustOrExisting[prometheus.Counter](reg, prometheus.NewCounter(prometheus.CounterOpts{
+		Buckets:   options.bucketsFor(HistogramProducerSendDuration),
+	}, []string{"instance"}))
+	m.promConsumerReceived = mustOrExisting[*prometheus.CounterVec](reg, prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "lynx_rocketmq",
 		Subsystem: "consumer",
 		Name:      "messages_received_total",
 		Help:      "Total number of messages successfully processed by the consumer.",
-	}))
-	m.promConsumerFailed = mustOrExisting[prometheus.Counter](reg, prometheus.NewCounter(prometheus.CounterOpts{
+	}, []string{"instance"}))
+	m.promConsumerFailed = mustOrExisting[*prometheus.CounterVec](reg, prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "lynx_rocketmq",
 		Subsystem: "consumer",
 		Name:      "messages_failed_total",
 		Help:      "Total number of messages that failed processing and will be retried.",
-	}))
-	m.promConsumerLatency = mustOrExisting[prometheus.Histogram](reg, prometheus.NewHistogram(prometheus.HistogramOpts{
+	}, []string{"instance"}))
+	m.promConsumerLatency = mustOrExisting[*prometheus.HistogramVec](reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: "lynx_rocketmq",
 		Subsystem: "consumer",
 		Name:      "process_duration_seconds",
 		Help:      "Histogram of consumer message-processing latency in seconds.",
-		Buckets:   prometheus.DefBuckets,
-	}))
+		Buckets:   options.bucketsFor(HistogramConsumerProcessDuration),
+	}, []string{"instance"}))
 	m.promConnErrors = mustOrExisting[prometheus.Counter](reg, prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "lynx_rocketmq",
 		Subsystem: "connection",
@@ -120,8 +251,74 @@ func newMetricsWithRegisterer(reg prometheus.Registerer) *Metrics {
 		Name:      "check_errors_total",
 		Help:      "Total number of failed health checks.",
 	}))
+	m.promHealthStatus = mustOrExisting[*prometheus.GaugeVec](reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "lynx_rocketmq",
+		Subsystem: "health",
+		Name:      "check_status",
+		Help:      "Result of the last health check per check name (1 = healthy, 0 = unhealthy); name=\"aggregate\" is the overall state.",
+	}, []string{"name"}))
+	m.promHealthSLA = mustOrExisting[prometheus.Counter](reg, prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "lynx_rocketmq",
+		Subsystem: "health",
+		Name:      "check_sla_violations_total",
+		Help:      "Total number of passing health checks that exceeded the response time SLA.",
+	}))
+	m.promLoadShed = mustOrExisting[*prometheus.CounterVec](reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lynx_rocketmq",
+		Subsystem: "producer",
+		Name:      "load_shed_total",
+		Help:      "Total number of messages dropped by a LoadShedder while the producer was overloaded.",
+	}, []string{"instance"}))
+	m.promTopicMismatch = mustOrExisting[*prometheus.CounterVec](reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lynx_rocketmq",
+		Subsystem: "consumer",
+		Name:      "topic_mismatch_total",
+		Help:      "Total number of messages received for a topic the consumer is not subscribed to.",
+	}, []string{"instance"}))
+	m.promFingerprintHit = mustOrExisting[*prometheus.CounterVec](reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lynx_rocketmq",
+		Subsystem: "consumer",
+		Name:      "fingerprint_cache_hits_total",
+		Help:      "Total number of messages skipped as duplicates by their body fingerprint.",
+	}, []string{"instance"}))
+	m.promFingerprintMiss = mustOrExisting[*prometheus.CounterVec](reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lynx_rocketmq",
+		Subsystem: "consumer",
+		Name:      "fingerprint_cache_misses_total",
+		Help:      "Total number of messages whose body fingerprint was not seen before.",
+	}, []string{"instance"}))
 
-	return m
+	for name, h := range map[string]*prometheus.HistogramVec{
+		HistogramProducerSendDuration:    m.promProducerLatency,
+		HistogramConsumerProcessDuration: m.promConsumerLatency,
+	} {
+		want, ok := options.buckets[name]
+		if !ok {
+			continue
+		}
+		if got := histogramUpperBounds(h); !slices.Equal(got, want) {
+			return nil, WrapError(ErrInvalidConfiguration, fmt.Sprintf("histogram %s already registered with buckets %v", name, got))
+		}
+	}
+	return m, nil
+}
+
+// bucketProbeInstance is the instance label of the throwaway series
+// histogramUpperBounds reads the buckets from.
+const bucketProbeInstance = "__bucket_probe__"
+
+// histogramUpperBounds returns the bucket upper bounds of vec, without +Inf.
+func histogramUpperBounds(vec *prometheus.HistogramVec) []float64 {
+	defer vec.DeleteLabelValues(bucketProbeInstance)
+	var metric dto.Metric
+	if err := vec.WithLabelValues(bucketProbeInstance).(prometheus.Histogram).Write(&metric); err != nil {
+		return nil
+	}
+	var bounds []float64
+	for _, b := range metric.GetHistogram().GetBucket() {
+		bounds = append(bounds, b.GetUpperBound())
+	}
+	return bounds
 }
 
 // mustOrExisting registers c with reg. If the metric is already registered the
@@ -139,40 +336,107 @@ func mustOrExisting[T prometheus.Collector](reg prometheus.Registerer, c T) T {
 	return c
 }
 
+// instanceMetrics records the metrics of one producer or consumer instance:
+// the process-wide in-process counters, and the Prometheus series labelled
+// with its instance name.
+type instanceMetrics struct {
+	m        *Metrics
+	instance string
+}
+
+// forInstance returns the metrics recorder for the named instance.
+func (m *Metrics) forInstance(instance string) instanceMetrics {
+	return instanceMetrics{m: m, instance: instance}
+}
+
 // IncrementProducerMessagesSent increments the successful producer send counter.
 func (m *Metrics) IncrementProducerMessagesSent() {
-	atomic.AddInt64(&m.producerMessagesSent, 1)
-	m.promProducerSent.Inc()
+	m.forInstance("").IncrementProducerMessagesSent()
 }
 
 // IncrementProducerMessagesFailed increments the failed producer send counter.
 func (m *Metrics) IncrementProducerMessagesFailed() {
-	atomic.AddInt64(&m.producerMessagesFailed, 1)
-	m.promProducerFailed.Inc()
+	m.forInstance("").IncrementProducerMessagesFailed()
 }
 
 // RecordProducerLatency records a producer send latency observation.
 func (m *Metrics) RecordProducerLatency(duration time.Duration) {
-	atomic.StoreInt64(&m.producerLatency, int64(duration))
-	m.promProducerLatency.Observe(duration.Seconds())
+	m.forInstance("").RecordProducerLatency(duration)
 }
 
 // IncrementConsumerMessagesReceived increments the successful consumer receive counter.
 func (m *Metrics) IncrementConsumerMessagesReceived() {
-	atomic.AddInt64(&m.consumerMessagesReceived, 1)
-	m.promConsumerReceived.Inc()
+	m.forInstance("").IncrementConsumerMessagesReceived()
 }
 
 // IncrementConsumerMessagesFailed increments the failed consumer processing counter.
 func (m *Metrics) IncrementConsumerMessagesFailed() {
-	atomic.AddInt64(&m.consumerMessagesFailed, 1)
-	m.promConsumerFailed.Inc()
+	m.forInstance("").IncrementConsumerMessagesFailed()
 }
 
 // RecordConsumerLatency records a consumer message-processing latency observation.
 func (m *Metrics) RecordConsumerLatency(duration time.Duration) {
-	atomic.StoreInt64(&m.consumerLatency, int64(duration))
-	m.promConsumerLatency.Observe(duration.Seconds())
+	m.forInstance("").RecordConsumerLatency(duration)
+}
+
+// IncrementProducerMessagesSent is Metrics.IncrementProducerMessagesSent for the instance.
+func (im instanceMetrics) IncrementProducerMessagesSent() {
+	atomic.AddInt64(&im.m.producerMessagesSent, 1)
+	im.m.promProducerSent.WithLabelValues(im.instance).Inc()
+}
+
+// IncrementProducerMessagesFailed is Metrics.IncrementProducerMessagesFailed for the instance.
+func (im instanceMetrics) IncrementProducerMessagesFailed() {
+	atomic.AddInt64(&im.m.producerMessagesFailed, 1)
+	im.m.promProducerFailed.WithLabelValues(im.instance).Inc()
+}
+
+// RecordProducerLatency is Metrics.RecordProducerLatency for the instance.
+func (im instanceMetrics) RecordProducerLatency(duration time.Duration) {
+	atomic.StoreInt64(&im.m.producerLatency, int64(duration))
+	im.m.promProducerLatency.WithLabelValues(im.instance).Observe(duration.Seconds())
+}
+
+// IncrementConsumerMessagesReceived is Metrics.IncrementConsumerMessagesReceived for the instance.
+func (im instanceMetrics) IncrementConsumerMessagesReceived() {
+	atomic.AddInt64(&im.m.consumerMessagesReceived, 1)
+	im.m.promConsumerReceived.WithLabelValues(im.instance).Inc()
+}
+
+// IncrementConsumerMessagesFailed is Metrics.IncrementConsumerMessagesFailed for the instance.
+func (im instanceMetrics) IncrementConsumerMessagesFailed() {
+	atomic.AddInt64(&im.m.consumerMessagesFailed, 1)
+	im.m.promConsumerFailed.WithLabelValues(im.instance).Inc()
+}
+
+// RecordConsumerLatency is Metrics.RecordConsumerLatency for the instance.
+func (im instanceMetrics) RecordConsumerLatency(duration time.Duration) {
+	atomic.StoreInt64(&im.m.consumerLatency, int64(duration))
+	im.m.promConsumerLatency.WithLabelValues(im.instance).Observe(duration.Seconds())
+}
+
+// IncrementLoadShed is Metrics.IncrementLoadShed for the instance.
+func (im instanceMetrics) IncrementLoadShed() {
+	atomic.AddInt64(&im.m.loadShedCount, 1)
+	im.m.promLoadShed.WithLabelValues(im.instance).Inc()
+}
+
+// IncrementTopicMismatch is Metrics.IncrementTopicMismatch for the instance.
+func (im instanceMetrics) IncrementTopicMismatch() {
+	atomic.AddInt64(&im.m.topicMismatchCount, 1)
+	im.m.promTopicMismatch.WithLabelValues(im.instance).Inc()
+}
+
+// IncrementFingerprintCacheHit is Metrics.IncrementFingerprintCacheHit for the instance.
+func (im instanceMetrics) IncrementFingerprintCacheHit() {
+	atomic.AddInt64(&im.m.fingerprintCacheHitCount, 1)
+	im.m.promFingerprintHit.WithLabelValues(im.instance).Inc()
+}
+
+// IncrementFingerprintCacheMiss is Metrics.IncrementFingerprintCacheMiss for the instance.
+func (im instanceMetrics) IncrementFingerprintCacheMiss() {
+	atomic.AddInt64(&im.m.fingerprintCacheMissCount, 1)
+	im.m.promFingerprintMiss.WithLabelValues(im.instance).Inc()
 }
 
 // IncrementConnectionErrors increments the connection error counter.
@@ -201,13 +465,59 @@ func (m *Metrics) IncrementHealthCheckErrors() {
 	m.promHealthErrors.Inc()
 }
 
-// SetHealthy sets the binary health flag (1 = healthy, 0 = unhealthy).
+// IncrementHealthCheckSLAViolations increments the health-check SLA violation counter.
+func (m *Metrics) IncrementHealthCheckSLAViolations() {
+	atomic.AddInt64(&m.healthCheckSLAViolations, 1)
+	m.promHealthSLA.Inc()
+}
+
+// IncrementLoadShed increments the counter of messages dropped by a LoadShedder.
+func (m *Metrics) IncrementLoadShed() {
+	m.forInstance("").IncrementLoadShed()
+}
+
+// IncrementTopicMismatch increments the counter of messages received for an
+// unsubscribed topic.
+func (m *Metrics) IncrementTopicMismatch() {
+	m.forInstance("").IncrementTopicMismatch()
+}
+
+// IncrementFingerprintCacheHit increments the counter of messages skipped as
+// fingerprint duplicates.
+func (m *Metrics) IncrementFingerprintCacheHit() {
+	m.forInstance("").IncrementFingerprintCacheHit()
+}
+
+// IncrementFingerprintCacheMiss increments the counter of messages whose
+// fingerprint was not seen before.
+func (m *Metrics) IncrementFingerprintCacheMiss() {
+	m.forInstance("").IncrementFingerprintCacheMiss()
+}
+
+// SetHealthy sets the binary health flag (1 = healthy, 0 = unhealthy) and the
+// aggregate health_check_status gauge.
 func (m *Metrics) SetHealthy(healthy bool) {
 	if healthy {
 		atomic.StoreInt32(&m.isHealthy, 1)
 	} else {
 		atomic.StoreInt32(&m.isHealthy, 0)
 	}
+	m.SetHealthCheckStatus(aggregateHealthCheckName, healthy)
+}
+
+// SetHealthCheckStatus sets the health_check_status gauge for a named check.
+func (m *Metrics) SetHealthCheckStatus(name string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	m.promHealthStatus.WithLabelValues(name).Set(value)
+}
+
+// DeleteHealthCheckStatus removes the health_check_status series of a named
+// check that is no longer registered.
+func (m *Metrics) DeleteHealthCheckStatus(name string) {
+	m.promHealthStatus.DeleteLabelValues(name)
 }
 
 // UpdateLastHealthCheck records the current time as the last health-check timestamp.
@@ -232,6 +542,12 @@ type Stats struct {
 	HealthCheckErrors int64
 	LastHealthCheck   time.Time
 	IsHealthy         bool
+
+	HealthCheckSLAViolations  int64
+	LoadShedCount             int64
+	TopicMismatchCount        int64
+	FingerprintCacheHitCount  int64
+	FingerprintCacheMissCount int64
 }
 
 // GetStats returns a point-in-time snapshot of all counters.
@@ -255,6 +571,12 @@ func (m *Metrics) GetStats() Stats {
 		HealthCheckErrors: atomic.LoadInt64(&m.healthCheckErrors),
 		LastHealthCheck:   lastCheck,
 		IsHealthy:         atomic.LoadInt32(&m.isHealthy) == 1,
+
+		HealthCheckSLAViolations:  atomic.LoadInt64(&m.healthCheckSLAViolations),
+		LoadShedCount:             atomic.LoadInt64(&m.loadShedCount),
+		TopicMismatchCount:        atomic.LoadInt64(&m.topicMismatchCount),
+		FingerprintCacheHitCount:  atomic.LoadInt64(&m.fingerprintCacheHitCount),
+		FingerprintCacheMissCount: atomic.LoadInt64(&m.fingerprintCacheMissCount),
 	}
 }
 
@@ -274,6 +596,11 @@ func (m *Metrics) Reset() {
 	atomic.StoreInt64(&m.reconnectionCount, 0)
 	atomic.StoreInt64(&m.healthCheckCount, 0)
 	atomic.StoreInt64(&m.healthCheckErrors, 0)
+	atomic.StoreInt64(&m.healthCheckSLAViolations, 0)
+	atomic.StoreInt64(&m.loadShedCount, 0)
+	atomic.StoreInt64(&m.topicMismatchCount, 0)
+	atomic.StoreInt64(&m.fingerprintCacheHitCount, 0)
+	atomic.StoreInt64(&m.fingerprintCacheMissCount, 0)
 	atomic.StoreInt32(&m.isHealthy, 0)
 
 	m.lastReconnectTime = time.Time{}
@@ -1,6 +1,8 @@
 package rocketmq
 
 import (
+	"errors"
+	"slices"
 	"testing"
 	"time"
 
@@ -10,7 +12,8 @@ import (
 // newIsolatedMetrics creates a Metrics instance backed by a fresh Prometheus
 // registry to avoid duplicate-registration conflicts between test functions.
 func newIsolatedMetrics() *Metrics {
-	return newMetricsWithRegisterer(prometheus.NewRegistry())
+	m, _ := newMetricsWithRegisterer(prometheus.NewRegistry())
+	return m
 }
 
 func TestMetricsProducerCounters(t *testing.T) {
@@ -113,3 +116,55 @@ func TestMetricsReset(t *testing.T) {
 		t.Fatal("expected IsHealthy=false after reset")
 	}
 }
+
+func TestMetricsHistogramBuckets(t *testing.T) {
+	custom := []float64{0.001, 0.01, 0.1}
+	reg := prometheus.NewRegistry()
+	m, err := newMetricsWithRegisterer(reg, WithHistogramBuckets(HistogramProducerSendDuration, custom))
+	if err != nil {
+		t.Fatalf("newMetricsWithRegisterer failed: %v", err)
+	}
+	if got := histogramUpperBounds(m.promProducerLatency); !slices.Equal(got, custom) {
+		t.Fatalf("producer buckets = %v, want %v", got, custom)
+	}
+	if got := histogramUpperBounds(m.promConsumerLatency); !slices.Equal(got, prometheus.DefBuckets) {
+		t.Fatalf("unspecified histogram should keep the defaults, got %v", got)
+	}
+
+	for _, opt := range []MetricsOption{
+		WithHistogramBuckets(HistogramConsumerProcessDuration, []float64{0.5, 0.1}),
+		WithHistogramBuckets(HistogramConsumerProcessDuration, nil),
+		WithHistogramBuckets("queue_depth", custom),
+	} {
+		if _, err := newMetricsWithRegisterer(prometheus.NewRegistry(), opt); !errors.Is(err, ErrInvalidConfiguration) {
+			t.Fatalf("expected ErrInvalidConfiguration, got %v", err)
+		}
+	}
+
+	// The registered histogram is reused, so other buckets cannot apply.
+	if _, err := newMetricsWithRegisterer(reg, WithHistogramBuckets(HistogramProducerSendDuration, []float64{1, 2})); !errors.Is(err, ErrInvalidConfiguration) {
+		t.Fatalf("expected conflict with registered buckets, got %v", err)
+	}
+	if _, err := newMetricsWithRegisterer(reg, WithHistogramBuckets(HistogramProducerSendDuration, custom)); err != nil {
+		t.Fatalf("same buckets should reuse the registered histogram, got %v", err)
+	}
+}
+
+func TestSetMetricsOptions(t *testing.T) {
+	// Earlier clients registered the default histograms, so overrides can
+	// no longer take effect and must be reported rather than ignored.
+	NewRocketMQClient()
+	if err := SetMetricsOptions(WithHistogramBuckets(HistogramProducerSendDuration, []float64{0.25, 0.5})); !errors.Is(err, ErrInvalidConfiguration) {
+		t.Fatalf("expected conflict with registered buckets, got %v", err)
+	}
+	if err := SetMetricsOptions(WithHistogramBuckets(HistogramProducerSendDuration, []float64{1, 1})); !errors.Is(err, ErrInvalidConfiguration) {
+		t.Fatalf("expected invalid buckets to be rejected, got %v", err)
+	}
+	if err := SetMetricsOptions(WithHistogramBuckets(HistogramProducerSendDuration, prometheus.DefBuckets)); err != nil {
+		t.Fatalf("SetMetricsOptions failed: %v", err)
+	}
+	defer func() { _ = SetMetricsOptions() }()
+	if got := histogramUpperBounds(NewRocketMQClient().metrics.promProducerLatency); !slices.Equal(got, prometheus.DefBuckets) {
+		t.Fatalf("unexpected producer buckets %v", got)
+	}
+}
@@ -0,0 +1,147 @@
+package rocketmq
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+const (
+	// reqGetNamesrvConfig is the GET_NAMESRV_CONFIG request code; its reply
+	// is small and, like every reply, carries the server's version code.
+	reqGetNamesrvConfig = 319
+
+	// remotingClientVersion is the version code the Go SDK sends.
+	remotingClientVersion = 317
+
+	// maxRemotingFrameSize bounds the reply frames NameServerVersion reads.
+	maxRemotingFrameSize = 4 << 20
+
+	// remotingResponseFlag marks a remoting command as a reply.
+	remotingResponseFlag = 1
+)
+
+// remotingHeader is the JSON header of a RocketMQ remoting command.
+type remotingHeader struct {
+	Code      int16             `json:"code"`
+	Language  string            `json:"language"`
+	Version   int16             `json:"version"`
+	Opaque    int32             `json:"opaque"`
+	Flag      int32             `json:"flag"`
+	Remark    string            `json:"remark,omitempty"`
+	ExtFields map[string]string `json:"extFields,omitempty"`
+}
+
+// NameServerVersion asks every configured NameServer for its version and
+// returns the answers keyed by address. The version is the remoting version
+// code the server reports (the ordinal of the Java MQVersion enum), so
+// differing values reveal a mixed-version cluster. Addresses that do not
+// answer are missing from the map and their errors are joined into err, so a
+// partial map may come with a non-nil error.
+func (cm *ConnectionManager) NameServerVersion(ctx context.Context) (map[string]string, error) {
+	addrs := cm.addrs()
+	if len(addrs) == 0 {
+		return nil, ErrMissingNameServer
+	}
+
+	versions := make(map[string]string, len(addrs))
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			version, err := cm.queryVersion(ctx, addr)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, WrapError(err, "nameserver "+addr))
+				return
+			}
+			versions[addr] = version
+		}(addr)
+	}
+	wg.Wait()
+	return versions, errors.Join(errs...)
+}
+
+// queryVersion sends one GET_NAMESRV_CONFIG request to addr and returns the
+// version code of the reply.
+func (cm *ConnectionManager) queryVersion(ctx context.Context, addr string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, nameServerProbeTimeout)
+	defer cancel()
+
+	conn, err := cm.dial(ctx, addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	request := remotingHeader{Code: reqGetNamesrvConfig, Language: "GO", Version: remotingClientVersion, Opaque: 1}
+	if err := writeRemotingCommand(conn, request); err != nil {
+		return "", WrapError(err, "send version request")
+	}
+	reply, err := readRemotingCommand(conn)
+	if err != nil {
+		return "", WrapError(err, "read version reply")
+	}
+	if reply.Flag&remotingResponseFlag == 0 || reply.Opaque != request.Opaque {
+		return "", fmt.Errorf("unexpected remoting command in reply: code %d, opaque %d", reply.Code, reply.Opaque)
+	}
+	return strconv.Itoa(int(reply.Version)), nil
+}
+
+// writeRemotingCommand writes a body-less command with a JSON header:
+// frame length, header length (serialization type in the top byte), header.
+func writeRemotingCommand(w io.Writer, header remotingHeader) error {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, int32(4+len(data)))
+	_ = binary.Write(&buf, binary.BigEndian, int32(len(data)))
+	buf.Write(data)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// readRemotingCommand reads one command frame and decodes its JSON header;
+// the body is discarded.
+func readRemotingCommand(r io.Reader) (*remotingHeader, error) {
+	var frameSize int32
+	if err := binary.Read(r, binary.BigEndian, &frameSize); err != nil {
+		return nil, err
+	}
+	if frameSize < 4 || frameSize > maxRemotingFrameSize {
+		return nil, fmt.Errorf("invalid remoting frame size %d", frameSize)
+	}
+	frame := make([]byte, frameSize)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+
+	headerField := binary.BigEndian.Uint32(frame[:4])
+	if serialization := headerField >> 24; serialization != 0 {
+		return nil, fmt.Errorf("unsupported remoting serialization type %d", serialization)
+	}
+	headerLen := headerField & 0xFFFFFF
+	if int(headerLen) > len(frame)-4 {
+		return nil, fmt.Errorf("invalid remoting header length %d", headerLen)
+	}
+	var header remotingHeader
+	if err := json.Unmarshal(frame[4:4+headerLen], &header); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
@@ -0,0 +1,171 @@
+package rocketmq
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+// OffsetCheckpointStore persists per-queue consume offsets outside the broker,
+// so a consumer can resume from its own record of progress.
+type OffsetCheckpointStore interface {
+	// Save replaces the stored offsets with offsets.
+	Save(offsets map[primitive.MessageQueue]int64) error
+
+	// Load returns the stored offsets; it is empty when nothing was saved.
+	Load() (map[primitive.MessageQueue]int64, error)
+
+	// Flush makes previously saved offsets durable.
+	Flush() error
+}
+
+// checkpointEntry is the on-disk form of one queue offset.
+type checkpointEntry struct {
+	Topic      string `json:"topic"`
+	BrokerName string `json:"broker_name"`
+	QueueID    int    `json:"queue_id"`
+	Offset     int64  `json:"offset"`
+}
+
+// fileOffsetCheckpointStore keeps offsets in a single JSON file.
+type fileOffsetCheckpointStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// FileOffsetCheckpointStore returns an OffsetCheckpointStore backed by the JSON
+// file at path, which is created on the first Save. Save writes a temporary
+// file, fsyncs it and renames it over path, so neither readers nor a crash
+// ever see a partial checkpoint. It suits single-instance deployments only:
+// nothing coordinates consumers sharing the file.
+func FileOffsetCheckpointStore(path string) (OffsetCheckpointStore, error) {
+	if path == "" {
+		return nil, WrapError(ErrInvalidConfiguration, "offset checkpoint path is empty")
+	}
+	info, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return nil, WrapError(err, "offset checkpoint directory")
+	}
+	if !info.IsDir() {
+		return nil, WrapError(ErrInvalidConfiguration, "offset checkpoint directory is not a directory: "+filepath.Dir(path))
+	}
+	return &fileOffsetCheckpointStore{path: path}, nil
+}
+
+func (s *fileOffsetCheckpointStore) Save(offsets map[primitive.MessageQueue]int64) error {
+	entries := make([]checkpointEntry, 0, len(offsets))
+	for mq, offset := range offsets {
+		entries = append(entries, checkpointEntry{Topic: mq.Topic, BrokerName: mq.BrokerName, QueueID: mq.QueueId, Offset: offset})
+	}
+	// Sorted so unchanged offsets produce an identical file.
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		if a.BrokerName != b.BrokerName {
+			return a.BrokerName < b.BrokerName
+		}
+		return a.QueueID < b.QueueID
+	})
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return WrapError(err, "encode offset checkpoint")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return WrapError(err, "create offset checkpoint")
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return WrapError(err, "write offset checkpoint")
+	}
+	// Synced before the rename, so a crash never leaves a truncated file
+	// under the final name.
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return WrapError(err, "write offset checkpoint")
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return WrapError(err, "write offset checkpoint")
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return WrapError(err, "replace offset checkpoint")
+	}
+	if err := syncDir(filepath.Dir(s.path)); err != nil {
+		return WrapError(err, "sync offset checkpoint directory")
+	}
+	return nil
+}
+
+func (s *fileOffsetCheckpointStore) Load() (map[primitive.MessageQueue]int64, error) {
+	s.mu.Lock()
+	data, err := os.ReadFile(s.path)
+	s.mu.Unlock()
+
+	offsets := make(map[primitive.MessageQueue]int64)
+	if errors.Is(err, os.ErrNotExist) {
+		return offsets, nil
+	}
+	if err != nil {
+		return nil, WrapError(err, "read offset checkpoint")
+	}
+
+	var entries []checkpointEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, WrapError(err, "decode offset checkpoint "+s.path)
+	}
+	for _, e := range entries {
+		offsets[primitive.MessageQueue{Topic: e.Topic, BrokerName: e.BrokerName, QueueId: e.QueueID}] = e.Offset
+	}
+	return offsets, nil
+}
+
+// Flush fsyncs the checkpoint file and its directory. Every Save is already
+// durable when it returns, so this only re-asserts it.
+func (s *fileOffsetCheckpointStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Nothing saved yet.
+		return nil
+	}
+	if err != nil {
+		return WrapError(err, "flush offset checkpoint")
+	}
+	err = f.Sync()
+	_ = f.Close()
+	if err != nil {
+		return WrapError(err, "flush offset checkpoint")
+	}
+	if err := syncDir(filepath.Dir(s.path)); err != nil {
+		return WrapError(err, "flush offset checkpoint")
+	}
+	return nil
+}
+
+// syncDir fsyncs the directory dir, making renames within it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	_ = d.Close()
+	return err
+}
@@ -0,0 +1,85 @@
+package rocketmq
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+func TestFileOffsetCheckpointStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offsets.json")
+	store, err := FileOffsetCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("FileOffsetCheckpointStore failed: %v", err)
+	}
+
+	if offsets, err := store.Load(); err != nil || len(offsets) != 0 {
+		t.Fatalf("expected empty offsets before the first save, got %v, %v", offsets, err)
+	}
+
+	want := map[primitive.MessageQueue]int64{
+		{Topic: "orders", BrokerName: "broker-a", QueueId: 0}: 42,
+		{Topic: "orders", BrokerName: "broker-a", QueueId: 1}: 7,
+	}
+	if err := store.Save(want); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	reopened, err := FileOffsetCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	got, err := reopened.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !maps.Equal(got, want) {
+		t.Fatalf("Load = %v, want %v", got, want)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected only the checkpoint file, no leftover temp files, got %v", entries)
+	}
+}
+
+func TestFileOffsetCheckpointStoreConcurrentSaves(t *testing.T) {
+	store, err := FileOffsetCheckpointStore(filepath.Join(t.TempDir(), "offsets.json"))
+	if err != nil {
+		t.Fatalf("FileOffsetCheckpointStore failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(offset int64) {
+			defer wg.Done()
+			mq := primitive.MessageQueue{Topic: "orders", BrokerName: "broker-a"}
+			if err := store.Save(map[primitive.MessageQueue]int64{mq: offset}); err != nil {
+				t.Errorf("Save failed: %v", err)
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	if offsets, err := store.Load(); err != nil || len(offsets) != 1 {
+		t.Fatalf("expected one intact offset after concurrent saves, got %v, %v", offsets, err)
+	}
+}
+
+func TestFileOffsetCheckpointStoreInvalidPath(t *testing.T) {
+	if _, err := FileOffsetCheckpointStore(""); !errors.Is(err, ErrInvalidConfiguration) {
+		t.Fatalf("expected ErrInvalidConfiguration for empty path, got %v", err)
+	}
+	if _, err := FileOffsetCheckpointStore(filepath.Join(t.TempDir(), "missing", "offsets.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected missing directory error, got %v", err)
+	}
+}
@@ -2,154 +2,373 @@ package rocketmq
 
 import (
 	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/apache/rocketmq-client-go/v2"
 	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/go-lynx/lynx-rocketmq/internal/msgcopy"
 	"github.com/go-lynx/lynx/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // SendMessage sends a single message to the specified topic
 func (r *Client) SendMessage(ctx context.Context, topic string, body []byte) error {
-	return r.SendMessageWith(ctx, r.defaultProducer, topic, body)
+	return r.SendMessageWith(ctx, r.defaultProducerName(), topic, body)
 }
 
 // SendMessageSync sends a message synchronously
 func (r *Client) SendMessageSync(ctx context.Context, topic string, body []byte) (*primitive.SendResult, error) {
-	return r.SendMessageSyncWith(ctx, r.defaultProducer, topic, body)
+	return r.SendMessageSyncWith(ctx, r.defaultProducerName(), topic, body)
 }
 
 // SendMessageAsync sends a message asynchronously
 func (r *Client) SendMessageAsync(ctx context.Context, topic string, body []byte) error {
-	return r.SendMessageAsyncWith(ctx, r.defaultProducer, topic, body)
+	return r.SendMessageAsyncWith(ctx, r.defaultProducerName(), topic, body)
+}
+
+// SendWithHeaders merges headers into the properties of msg and sends it
+// through the default producer, saving producers that attach the same
+// request-level headers to every message from setting them one by one. Keys
+// msg already has with a different value are resolved by the producer's
+// WithHeaderConflictStrategy; with the default ErrorOnConflict msg is left
+// unchanged and ErrHeaderConflict is returned.
+func (r *Client) SendWithHeaders(ctx context.Context, msg *primitive.Message, headers map[string]string) (*primitive.SendResult, error) {
+	return r.SendWithHeadersWith(ctx, r.defaultProducerName(), msg, headers)
+}
+
+// SendWithHeadersWith is SendWithHeaders by producer instance name
+func (r *Client) SendWithHeadersWith(ctx context.Context, producerName string, msg *primitive.Message, headers map[string]string) (*primitive.SendResult, error) {
+	if msg == nil {
+		r.producerMetrics(producerName).IncrementProducerMessagesFailed()
+		return nil, ErrInvalidMessage
+	}
+	strategy := r.producerOptions(producerName).headerConflicts
+	if strategy == ErrorOnConflict {
+		for key, value := range headers {
+			if existing := msg.GetProperty(key); existing != "" && existing != value {
+				r.producerMetrics(producerName).IncrementProducerMessagesFailed()
+				return nil, WrapError(ErrHeaderConflict, key)
+			}
+		}
+	}
+	for key, value := range headers {
+		if strategy == PreferMessage && msg.GetProperty(key) != "" {
+			continue
+		}
+		msg.WithProperty(key, value)
+	}
+	return r.sendSync(ctx, producerName, msg)
 }
 
 // SendMessageWith sends a message by producer instance name
 func (r *Client) SendMessageWith(ctx context.Context, producerName, topic string, body []byte) error {
-	start := time.Now()
-	defer func() {
-		r.metrics.RecordProducerLatency(time.Since(start))
-	}()
+	_, err := r.sendSync(ctx, producerName, primitive.NewMessage(topic, body))
+	return err
+}
 
-	if err := validateTopic(topic); err != nil {
-		r.metrics.IncrementProducerMessagesFailed()
-		return WrapError(err, "invalid topic")
-	}
+// SendMessageSyncWith sends a message synchronously by producer instance name
+func (r *Client) SendMessageSyncWith(ctx context.Context, producerName, topic string, body []byte) (*primitive.SendResult, error) {
+	return r.sendSync(ctx, producerName, primitive.NewMessage(topic, body))
+}
 
-	if len(body) == 0 {
-		r.metrics.IncrementProducerMessagesFailed()
-		return ErrEmptyMessage
+// SendContext sends a prepared message (tags, keys, properties) through the
+// default producer. If ctx carries a recording span, messaging attributes are
+// added to it.
+func (r *Client) SendContext(ctx context.Context, msg *primitive.Message) (*primitive.SendResult, error) {
+	return r.SendContextWith(ctx, r.defaultProducerName(), msg)
+}
+
+// SendContextWith sends a prepared message by producer instance name
+func (r *Client) SendContextWith(ctx context.Context, producerName string, msg *primitive.Message) (*primitive.SendResult, error) {
+	if msg == nil {
+		r.producerMetrics(producerName).IncrementProducerMessagesFailed()
+		return nil, ErrInvalidMessage
 	}
+	return r.sendSync(ctx, producerName, msg)
+}
 
-	producer, err := r.GetProducer(producerName)
-	if err != nil {
-		r.metrics.IncrementProducerMessagesFailed()
-		return err
+// delayLevels are the broker's default messageDelayLevel durations; level n
+// is delayLevels[n-1].
+var delayLevels = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute, 5 * time.Minute,
+	6 * time.Minute, 7 * time.Minute, 8 * time.Minute, 9 * time.Minute, 10 * time.Minute,
+	20 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour,
+}
+
+// propertyTimerDeliverMs is the RocketMQ 5.x property holding the absolute
+// delivery time of a timer message, in Unix milliseconds.
+const propertyTimerDeliverMs = "TIMER_DELIVER_MS"
+
+// SendAt sends msg through the default producer for delivery at deliverAt.
+//
+// RocketMQ 4.x only supports fixed delay levels, so the delay is rounded to
+// the nearest level of the broker's default table (1s 5s 10s 30s 1m–10m 20m
+// 30m 1h 2h) and capped at 2h; actual delivery can differ from deliverAt by
+// up to half the gap between adjacent levels. Producers configured
+// WithTimerMessages use 5.x timer messages and deliver at the exact time.
+// msg is modified to carry the delay.
+func (r *Client) SendAt(ctx context.Context, msg *primitive.Message, deliverAt time.Time) (*primitive.SendResult, error) {
+	return r.SendAtWith(ctx, r.defaultProducerName(), msg, deliverAt)
+}
+
+// SendAtWith is SendAt by producer instance name
+func (r *Client) SendAtWith(ctx context.Context, producerName string, msg *primitive.Message, deliverAt time.Time) (*primitive.SendResult, error) {
+	if msg == nil {
+		r.producerMetrics(producerName).IncrementProducerMessagesFailed()
+		return nil, ErrInvalidMessage
+	}
+	delay := time.Until(deliverAt)
+	if delay < 0 {
+		r.producerMetrics(producerName).IncrementProducerMessagesFailed()
+		return nil, WrapError(ErrDeliveryTimeInPast, "deliverAt "+deliverAt.Format(time.RFC3339))
 	}
 
-	msg := primitive.NewMessage(topic, body)
+	if r.producerOptions(producerName).timerMessages {
+		msg.WithProperty(propertyTimerDeliverMs, strconv.FormatInt(deliverAt.UnixMilli(), 10))
+	} else {
+		msg.WithDelayTimeLevel(nearestDelayLevel(delay))
+	}
+	return r.sendSync(ctx, producerName, msg)
+}
 
-	// SendSync is retried with backoff; the broker also performs its own
-	// internal retries up to the producer's configured MaxRetries.
-	err = r.retryHandler.DoWithRetry(ctx, func() error {
-		_, err := producer.SendSync(ctx, msg)
-		return err
-	})
+// applyTagSelector tags msg using the WithTagSelector function, unless msg
+// already has a tag.
+func applyTagSelector(opts producerOptions, msg *primitive.Message) {
+	if opts.tagSelector == nil || msg.GetTags() != "" {
+		return
+	}
+	if tag := opts.tagSelector(msg); tag != "" {
+		msg.WithTag(tag)
+	}
+}
 
-	if err != nil {
-		r.metrics.IncrementProducerMessagesFailed()
-		log.Error("Failed to send RocketMQ message", "producer", producerName, "topic", topic, "error", err)
-		return WrapError(err, "failed to send message")
+// applyTopicSelector returns msg, or a copy of it on the topic picked by the
+// WithTopicSelector selector when msg has no topic.
+func (r *Client) applyTopicSelector(producerName string, msg *primitive.Message) *primitive.Message {
+	if msg.Topic != "" {
+		return msg
 	}
+	sel := r.producerOptions(producerName).topicSelector
+	if sel == nil {
+		return msg
+	}
+	clone := msgcopy.Message(msg)
+	clone.Topic = sel.Select()
+	return clone
+}
 
-	r.metrics.IncrementProducerMessagesSent()
-	log.Debug("Sent RocketMQ message", "producer", producerName, "topic", topic)
-	return nil
+// nearestDelayLevel returns the delay level whose duration is closest to d.
+func nearestDelayLevel(d time.Duration) int {
+	best := 1
+	for i, level := range delayLevels {
+		if (level - d).Abs() < (delayLevels[best-1] - d).Abs() {
+			best = i + 1
+		}
+	}
+	return best
 }
 
-// SendMessageSyncWith sends a message synchronously by producer instance name
-func (r *Client) SendMessageSyncWith(ctx context.Context, producerName, topic string, body []byte) (*primitive.SendResult, error) {
+// sendSync is the shared synchronous send path: it validates msg, sends it
+// with retry, and records metrics and span attributes.
+func (r *Client) sendSync(ctx context.Context, producerName string, msg *primitive.Message) (*primitive.SendResult, error) {
 	start := time.Now()
+	metrics := r.producerMetrics(producerName)
 	defer func() {
-		r.metrics.RecordProducerLatency(time.Since(start))
+		metrics.RecordProducerLatency(time.Since(start))
 	}()
 
-	if err := validateTopic(topic); err != nil {
-		r.metrics.IncrementProducerMessagesFailed()
+	msg = r.applyTopicSelector(producerName, msg)
+	if err := validateTopic(msg.Topic); err != nil {
+		metrics.IncrementProducerMessagesFailed()
 		return nil, WrapError(err, "invalid topic")
 	}
 
-	if len(body) == 0 {
-		r.metrics.IncrementProducerMessagesFailed()
+	if len(msg.Body) == 0 {
+		metrics.IncrementProducerMessagesFailed()
 		return nil, ErrEmptyMessage
 	}
 
+	if !r.beginSend() {
+		metrics.IncrementProducerMessagesFailed()
+		return nil, WrapError(ErrProducerNotReady, "client is shutting down")
+	}
+	defer r.endSend()
+
 	producer, err := r.GetProducer(producerName)
 	if err != nil {
-		r.metrics.IncrementProducerMessagesFailed()
+		metrics.IncrementProducerMessagesFailed()
 		return nil, err
 	}
 
-	msg := primitive.NewMessage(topic, body)
+	state := r.lookupProducerState(producerName)
+	if state == nil {
+		// Shut down since GetProducer.
+		metrics.IncrementProducerMessagesFailed()
+		return nil, ErrProducerNotReady
+	}
+	counters := state.topicCounters(msg.Topic)
+	if err := state.waitRateLimit(ctx, msg.Topic); err != nil {
+		metrics.IncrementProducerMessagesFailed()
+		counters.record(time.Since(start), 0, err)
+		return nil, err
+	}
+	opts := state.options()
+	ns := opts.topicNamespace
+	instance := opts.instance(producerName)
+	applyTagSelector(opts, msg)
+
+	span := trace.SpanFromContext(ctx)
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("messaging.system", "rocketmq"),
+			attribute.String("messaging.destination.name", msg.Topic),
+			attribute.String("messaging.rocketmq.producer", producerName),
+			attribute.Int("messaging.message.body.size", len(msg.Body)),
+		)
+		if tag := msg.GetTags(); tag != "" {
+			span.SetAttributes(attribute.String("messaging.rocketmq.message.tag", tag))
+		}
+	}
 
+	// SendSync is retried with backoff; the broker also performs its own
+	// internal retries up to the producer's configured MaxRetries.
+	//
+	// Every retry sends the same message, and the SDK assigns the client
+	// message ID (UNIQ_KEY) to it only when it has none, so all attempts
+	// carry the ID of the first. If an attempt reached the broker but its ACK
+	// was lost, the retry is stored as a second copy with the same message
+	// ID; RocketMQ brokers do not drop it, but consumers can deduplicate on
+	// MsgId.
 	var result *primitive.SendResult
+	physical := withNamespace(ns, msg)
+	attempts := 0
 	err = r.retryHandler.DoWithRetry(ctx, func() error {
+		attempts++
 		var sendErr error
-		result, sendErr = producer.SendSync(ctx, msg)
+		result, sendErr = producer.SendSync(ctx, physical)
 		return sendErr
 	})
+	if attempts > 1 {
+		atomic.AddInt64(&counters.retries, int64(attempts-1))
+	}
+	counters.record(time.Since(start), len(msg.Body), err)
 
 	if err != nil {
-		r.metrics.IncrementProducerMessagesFailed()
-		log.Error("Failed to send RocketMQ message sync", "producer", producerName, "topic", topic, "error", err)
+		err = stripNamespace(ns, err)
+		metrics.IncrementProducerMessagesFailed()
+		log.Error("Failed to send RocketMQ message", "producer", producerName, "instance", instance, "topic", msg.Topic, "error", err)
 		return nil, WrapError(err, "failed to send message")
 	}
 
-	r.metrics.IncrementProducerMessagesSent()
-	log.Debug("Sent RocketMQ message sync", "producer", producerName, "topic", topic, "msgId", result.MsgID)
+	stripResultNamespace(ns, result)
+	if span.IsRecording() {
+		span.SetAttributes(attribute.String("messaging.message.id", result.MsgID))
+	}
+
+	metrics.IncrementProducerMessagesSent()
+	log.Debug("Sent RocketMQ message", "producer", producerName, "instance", instance, "topic", msg.Topic, "msgId", result.MsgID)
 	return result, nil
 }
 
 // SendMessageAsyncWith sends a message asynchronously by producer instance name
 func (r *Client) SendMessageAsyncWith(ctx context.Context, producerName, topic string, body []byte) error {
+	return r.sendAsync(ctx, producerName, primitive.NewMessage(topic, body), nil)
+}
+
+// sendAsync is the shared asynchronous send path. The returned error only
+// reports submission failures; the delivery outcome is recorded in metrics
+// and, when onResult is non-nil, passed to it from the SDK's callback.
+func (r *Client) sendAsync(ctx context.Context, producerName string, msg *primitive.Message, onResult func(*primitive.SendResult, error)) error {
 	start := time.Now()
+	metrics := r.producerMetrics(producerName)
 	defer func() {
-		r.metrics.RecordProducerLatency(time.Since(start))
+		metrics.RecordProducerLatency(time.Since(start))
 	}()
 
+	msg = r.applyTopicSelector(producerName, msg)
+	topic := msg.Topic
 	if err := validateTopic(topic); err != nil {
-		r.metrics.IncrementProducerMessagesFailed()
+		metrics.IncrementProducerMessagesFailed()
 		return WrapError(err, "invalid topic")
 	}
 
-	if len(body) == 0 {
-		r.metrics.IncrementProducerMessagesFailed()
+	if len(msg.Body) == 0 {
+		metrics.IncrementProducerMessagesFailed()
 		return ErrEmptyMessage
 	}
 
 	producer, err := r.GetProducer(producerName)
 	if err != nil {
-		r.metrics.IncrementProducerMessagesFailed()
+		metrics.IncrementProducerMessagesFailed()
 		return err
 	}
 
-	msg := primitive.NewMessage(topic, body)
+	state := r.lookupProducerState(producerName)
+	if state == nil {
+		// Shut down since GetProducer.
+		metrics.IncrementProducerMessagesFailed()
+		return ErrProducerNotReady
+	}
+	counters := state.topicCounters(topic)
+	if err := state.waitRateLimit(ctx, topic); err != nil {
+		metrics.IncrementProducerMessagesFailed()
+		counters.record(time.Since(start), 0, err)
+		return err
+	}
+	opts := state.options()
+	ns := opts.topicNamespace
+	instance := opts.instance(producerName)
+	applyTagSelector(opts, msg)
+
+	if !r.beginSend() {
+		metrics.IncrementProducerMessagesFailed()
+		return WrapError(ErrProducerNotReady, "client is shutting down")
+	}
+	releaseSlot, err := state.acquirePending(ctx)
+	if err != nil {
+		r.endSend()
+		metrics.IncrementProducerMessagesFailed()
+		counters.record(time.Since(start), 0, err)
+		return err
+	}
+	atomic.AddInt64(&counters.pending, 1)
+	release := sync.OnceFunc(func() {
+		releaseSlot()
+		atomic.AddInt64(&counters.pending, -1)
+		r.endSend()
+	})
+	bodySize := len(msg.Body)
 
 	// Async send: success/failure is reported via the callback, not the return
 	// value (which only surfaces submission errors).
 	err = producer.SendAsync(ctx, func(ctx context.Context, result *primitive.SendResult, err error) {
+		release()
+		err = stripNamespace(ns, err)
+		stripResultNamespace(ns, result)
+		counters.record(time.Since(start), bodySize, err)
 		if err != nil {
-			r.metrics.IncrementProducerMessagesFailed()
-			log.Error("Failed to send RocketMQ message async", "producer", producerName, "topic", topic, "error", err)
+			metrics.IncrementProducerMessagesFailed()
+			log.Error("Failed to send RocketMQ message async", "producer", producerName, "instance", instance, "topic", topic, "error", err)
 		} else {
-			r.metrics.IncrementProducerMessagesSent()
-			log.Debug("Sent RocketMQ message async", "producer", producerName, "topic", topic, "msgId", result.MsgID)
+			metrics.IncrementProducerMessagesSent()
+			log.Debug("Sent RocketMQ message async", "producer", producerName, "instance", instance, "topic", topic, "msgId", result.MsgID)
+		}
+		if onResult != nil {
+			onResult(result, err)
 		}
-	}, msg)
+	}, withNamespace(ns, msg))
 
 	if err != nil {
-		r.metrics.IncrementProducerMessagesFailed()
-		log.Error("Failed to send RocketMQ message async", "producer", producerName, "topic", topic, "error", err)
+		release()
+		err = stripNamespace(ns, err)
+		counters.record(time.Since(start), 0, err)
+		metrics.IncrementProducerMessagesFailed()
+		log.Error("Failed to send RocketMQ message async", "producer", producerName, "instance", instance, "topic", topic, "error", err)
 		return WrapError(err, "failed to send message async")
 	}
 
@@ -0,0 +1,169 @@
+package rocketmq
+
+import "github.com/apache/rocketmq-client-go/v2/primitive"
+
+// ProducerOption configures how a producer instance sends messages. Options
+// are applied with ConfigureProducer and take effect on the next send.
+type ProducerOption func(*producerOptions)
+
+// producerOptions holds the per-producer settings read on the send path.
+type producerOptions struct {
+	// rateLimit caps sends per second across all topics; 0 disables it.
+	rateLimit float64
+
+	// topicRateLimits caps sends per second for individual topics, on top of
+	// rateLimit.
+	topicRateLimits map[string]float64
+
+	// timerMessages makes SendAt use RocketMQ 5.x timer messages instead of
+	// delay levels.
+	timerMessages bool
+
+	// topicNamespace is prepended to topics as "<ns>%<topic>" on send.
+	topicNamespace string
+
+	// tagSelector derives the tag of messages sent without one.
+	tagSelector func(msg *primitive.Message) string
+
+	// topicSelector picks the topic of messages sent without one.
+	topicSelector *WeightedTopicSelector
+
+	// instanceName labels the producer in log lines and metrics.
+	instanceName string
+
+	// maxPendingMessages caps in-flight async sends; 0 means unlimited.
+	maxPendingMessages int
+
+	// streamBufferSize is the number of batches SendBatchStream buffers.
+	streamBufferSize int
+
+	// headerConflicts resolves SendWithHeaders keys already set on a message.
+	headerConflicts HeaderConflictStrategy
+}
+
+// HeaderConflictStrategy decides what SendWithHeaders does with a header
+// whose key the message already carries with a different value.
+type HeaderConflictStrategy int
+
+const (
+	// ErrorOnConflict fails the send with ErrHeaderConflict. It is the default.
+	ErrorOnConflict HeaderConflictStrategy = iota
+	// PreferHeader overwrites the message property with the header.
+	PreferHeader
+	// PreferMessage keeps the message property and ignores the header.
+	PreferMessage
+)
+
+// WithHeaderConflictStrategy sets how SendWithHeaders resolves headers that
+// conflict with properties already set on the message.
+func WithHeaderConflictStrategy(strategy HeaderConflictStrategy) ProducerOption {
+	return func(o *producerOptions) {
+		o.headerConflicts = strategy
+	}
+}
+
+// WithRateLimit caps the producer at rps messages per second across all
+// topics. Sends block until a token is available or ctx is done.
+func WithRateLimit(rps float64) ProducerOption {
+	return func(o *producerOptions) {
+		o.rateLimit = rps
+	}
+}
+
+// WithTopicRateLimit caps sends to topic at rps messages per second. It is
+// applied after the global WithRateLimit, so a message must pass both.
+func WithTopicRateLimit(topic string, rps float64) ProducerOption {
+	return func(o *producerOptions) {
+		if o.topicRateLimits == nil {
+			o.topicRateLimits = make(map[string]float64)
+		}
+		o.topicRateLimits[topic] = rps
+	}
+}
+
+// WithTimerMessages makes SendAt schedule messages with the precise timer
+// message feature of RocketMQ 5.x brokers instead of rounding to a delay
+// level. Brokers older than 5.0 ignore the timer property and deliver
+// immediately.
+func WithTimerMessages(enabled bool) ProducerOption {
+	return func(o *producerOptions) {
+		o.timerMessages = enabled
+	}
+}
+
+// WithTopicNamespace sends every message to "<ns>%<topic>", RocketMQ's
+// namespace convention for multi-tenant clusters. Callers keep using logical
+// topic names: the prefix is set on a copy of the message just before the
+// send and stripped from send results and returned errors.
+func WithTopicNamespace(ns string) ProducerOption {
+	return func(o *producerOptions) {
+		o.topicNamespace = ns
+	}
+}
+
+// WithTagSelector derives the tag of each message sent without an explicit
+// tag from fn, e.g. from an event_type property:
+//
+//	client.ConfigureProducer("", WithTagSelector(func(msg *primitive.Message) string {
+//		return msg.GetProperty("event_type")
+//	}))
+//
+// An empty result leaves the message untagged.
+func WithTagSelector(fn func(msg *primitive.Message) string) ProducerOption {
+	return func(o *producerOptions) {
+		o.tagSelector = fn
+	}
+}
+
+// WithTopicSelector routes each message sent without a topic to a topic
+// picked by sel, e.g. to split traffic between topic versions:
+//
+//	selector, _ := NewWeightedTopicSelector(map[string]int{"orders-v1": 90, "orders-v2": 10})
+//	client.ConfigureProducer("", WithTopicSelector(selector))
+//	_, err := client.SendContext(ctx, primitive.NewMessage("", body))
+//
+// The topic is set on a copy of the message, so the same message can be sent
+// again and is routed anew. Messages with an explicit topic are unaffected.
+func WithTopicSelector(sel *WeightedTopicSelector) ProducerOption {
+	return func(o *producerOptions) {
+		o.topicSelector = sel
+	}
+}
+
+// WithNamedInstance sets the name that identifies the producer in log lines
+// and in the instance label of its Prometheus metrics, to tell apart
+// producers of the same topic within one process. It defaults to the
+// producer's configured name. Prometheus renames the label to
+// exported_instance on scrape unless honor_labels is set.
+func WithNamedInstance(name string) ProducerOption {
+	return func(o *producerOptions) {
+		o.instanceName = name
+	}
+}
+
+// instance returns the instance name for log lines and metrics.
+func (o producerOptions) instance(producerName string) string {
+	if o.instanceName != "" {
+		return o.instanceName
+	}
+	return producerName
+}
+
+// WithStreamBufferSize sets how many batches SendBatchStream reads ahead of
+// the broker, and how many results it holds for a slow reader, before it
+// stops reading the input channel. It defaults to defaultStreamBufferSize.
+func WithStreamBufferSize(n int) ProducerOption {
+	return func(o *producerOptions) {
+		o.streamBufferSize = n
+	}
+}
+
+// WithMaxPendingMessages limits the producer to n async sends awaiting a
+// broker response. Further async sends block until a slot frees up or ctx is
+// done, so a slow broker applies backpressure instead of letting in-flight
+// messages pile up. PendingCount reports the current number.
+func WithMaxPendingMessages(n int) ProducerOption {
+	return func(o *producerOptions) {
+		o.maxPendingMessages = n
+	}
+}
@@ -0,0 +1,353 @@
+package rocketmq
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/go-lynx/lynx-rocketmq/internal/msgcopy"
+)
+
+// producerState is the runtime state the plugin keeps per producer instance:
+// its options and the rate limiters derived from them.
+type producerState struct {
+	name string
+
+	mu      sync.RWMutex
+	opts    producerOptions
+	limiter *rateLimiter
+	// topicLimiters maps topic → *rateLimiter, created on first send.
+	topicLimiters *sync.Map
+
+	// pendingSlots bounds in-flight async sends; nil when unlimited.
+	pendingSlots chan struct{}
+	pending      int64
+
+	// topicStats maps topic → *topicCounters, created on first send.
+	topicStats sync.Map
+}
+
+// topicCounters are the per-topic send counters behind TopicMetrics.
+type topicCounters struct {
+	sent      int64
+	errors    int64
+	retries   int64
+	bytes     int64
+	latencyNs int64
+	pending   int64
+}
+
+// TopicMetrics is a snapshot of a producer's sends to one topic.
+type TopicMetrics struct {
+	TotalSent          int64
+	TotalErrors        int64
+	TotalRetries       int64
+	TotalBytesProduced int64
+
+	// AverageSendLatency is the mean time from send to outcome over all
+	// sent and failed messages, including retries.
+	AverageSendLatency time.Duration
+
+	// CurrentQueueCount is the number of async sends awaiting a broker
+	// response.
+	CurrentQueueCount int
+}
+
+// record counts the outcome of one send that took d.
+func (c *topicCounters) record(d time.Duration, bytes int, err error) {
+	if err != nil {
+		atomic.AddInt64(&c.errors, 1)
+	} else {
+		atomic.AddInt64(&c.sent, 1)
+		atomic.AddInt64(&c.bytes, int64(bytes))
+	}
+	atomic.AddInt64(&c.latencyNs, int64(d))
+}
+
+func (c *topicCounters) snapshot() TopicMetrics {
+	m := TopicMetrics{
+		TotalSent:          atomic.LoadInt64(&c.sent),
+		TotalErrors:        atomic.LoadInt64(&c.errors),
+		TotalRetries:       atomic.LoadInt64(&c.retries),
+		TotalBytesProduced: atomic.LoadInt64(&c.bytes),
+		CurrentQueueCount:  int(atomic.LoadInt64(&c.pending)),
+	}
+	if n := m.TotalSent + m.TotalErrors; n > 0 {
+		m.AverageSendLatency = time.Duration(atomic.LoadInt64(&c.latencyNs) / n)
+	}
+	return m
+}
+
+func newProducerState(name string) *producerState {
+	return &producerState{
+		name:          name,
+		topicLimiters: &sync.Map{},
+	}
+}
+
+// topicCounters returns the counters of topic, creating them on first use.
+func (s *producerState) topicCounters(topic string) *topicCounters {
+	if c, ok := s.topicStats.Load(topic); ok {
+		return c.(*topicCounters)
+	}
+	c, _ := s.topicStats.LoadOrStore(topic, &topicCounters{})
+	return c.(*topicCounters)
+}
+
+// defaultProducerName returns the name of the default producer; it changes
+// on startup and shutdown.
+func (r *Client) defaultProducerName() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defaultProducer
+}
+
+// lookupProducerState returns the state for the named producer, or nil when
+// the name was neither configured nor started. An empty name resolves to the
+// default producer.
+func (r *Client) lookupProducerState(name string) *producerState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name == "" {
+		name = r.defaultProducer
+	}
+	return r.producerStates[name]
+}
+
+// producerOptions returns the options of the named producer, or the zero
+// options for an unknown name.
+func (r *Client) producerOptions(name string) producerOptions {
+	if state := r.lookupProducerState(name); state != nil {
+		return state.options()
+	}
+	return producerOptions{}
+}
+
+// producerMetrics returns the metrics recorder of the named producer,
+// labelled with its instance name.
+func (r *Client) producerMetrics(name string) instanceMetrics {
+	return r.metrics.forInstance(r.producerOptions(name).instance(name))
+}
+
+// producerState returns the state for the named producer, creating it on
+// first use. Only the configure and start paths call it; read-only accessors
+// use lookupProducerState so unknown names leave no entry behind.
+func (r *Client) producerState(name string) *producerState {
+	r.mu.RLock()
+	state, ok := r.producerStates[name]
+	r.mu.RUnlock()
+	if ok {
+		return state
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok = r.producerStates[name]
+	if !ok {
+		state = newProducerState(name)
+		r.producerStates[name] = state
+	}
+	return state
+}
+
+// ConfigureProducer applies opts to the named producer instance. An empty
+// name configures the default producer; before any producer has started, the
+// options are kept for the first producer to start, which becomes the
+// default.
+func (r *Client) ConfigureProducer(name string, opts ...ProducerOption) {
+	if name == "" {
+		r.mu.Lock()
+		if r.defaultProducer == "" {
+			r.defaultProducerOpts = append(r.defaultProducerOpts, opts...)
+			r.mu.Unlock()
+			return
+		}
+		name = r.defaultProducer
+		r.mu.Unlock()
+	}
+	r.producerState(name).apply(opts...)
+}
+
+// apply applies opts on top of the current options. A rate limiter or the
+// pending-send slots are rebuilt only when their own setting changed, so
+// token buckets keep their state and in-flight sends keep counting against
+// the max-pending cap across unrelated reconfiguration.
+func (s *producerState) apply(opts ...ProducerOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.opts
+	// WithTopicRateLimit writes into the map, so give it a fresh one to
+	// compare against prev.
+	s.opts.topicRateLimits = maps.Clone(prev.topicRateLimits)
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&s.opts)
+		}
+	}
+
+	if s.opts.rateLimit != prev.rateLimit {
+		s.limiter = newRateLimiter(s.opts.rateLimit)
+	}
+	// Changed per-topic limiters are recreated lazily on the next send.
+	for topic, rps := range s.opts.topicRateLimits {
+		if prevRPS, ok := prev.topicRateLimits[topic]; !ok || prevRPS != rps {
+			s.topicLimiters.Delete(topic)
+		}
+	}
+	for topic := range prev.topicRateLimits {
+		if _, ok := s.opts.topicRateLimits[topic]; !ok {
+			s.topicLimiters.Delete(topic)
+		}
+	}
+	if s.opts.maxPendingMessages != prev.maxPendingMessages {
+		s.pendingSlots = nil
+		if s.opts.maxPendingMessages > 0 {
+			s.pendingSlots = make(chan struct{}, s.opts.maxPendingMessages)
+		}
+	}
+}
+
+// acquirePending reserves a slot for an async send, blocking while the
+// WithMaxPendingMessages limit is reached. The returned func releases it.
+func (s *producerState) acquirePending(ctx context.Context) (func(), error) {
+	s.mu.RLock()
+	slots := s.pendingSlots
+	s.mu.RUnlock()
+
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, WrapError(ctx.Err(), "waiting for pending async send slot")
+		}
+	}
+	atomic.AddInt64(&s.pending, 1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(&s.pending, -1)
+			if slots != nil {
+				<-slots
+			}
+		})
+	}, nil
+}
+
+// PendingCount returns the number of async sends of the named producer that
+// are awaiting a broker response. An empty name resolves to the default
+// producer. It is 0 for an unknown producer.
+func (r *Client) PendingCount(producerName string) int {
+	state := r.lookupProducerState(producerName)
+	if state == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&state.pending))
+}
+
+// TopicMetrics returns the default producer's send counters for topic, for
+// assessing topic health without a Prometheus scrape. Counters start when the
+// producer first sends to the topic; sends rejected before reaching the
+// producer, e.g. for an invalid topic, are not counted.
+func (r *Client) TopicMetrics(topic string) TopicMetrics {
+	return r.TopicMetricsWith("", topic)
+}
+
+// TopicMetricsWith returns the named producer's send counters for topic. An
+// empty name resolves to the default producer.
+func (r *Client) TopicMetricsWith(producerName, topic string) TopicMetrics {
+	state := r.lookupProducerState(producerName)
+	if state == nil {
+		return TopicMetrics{}
+	}
+	c, ok := state.topicStats.Load(topic)
+	if !ok {
+		return TopicMetrics{}
+	}
+	return c.(*topicCounters).snapshot()
+}
+
+// options returns a copy of the current options.
+func (s *producerState) options() producerOptions {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.opts
+}
+
+// waitRateLimit blocks until both the global and the topic limiter admit one
+// message, or ctx is done.
+func (s *producerState) waitRateLimit(ctx context.Context, topic string) error {
+	s.mu.RLock()
+	limiter := s.limiter
+	topicLimiters := s.topicLimiters
+	topicRPS := s.opts.topicRateLimits[topic]
+	s.mu.RUnlock()
+
+	if limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return WrapError(err, "producer rate limit")
+		}
+	}
+
+	if topicRPS <= 0 {
+		return nil
+	}
+	topicLimiter, ok := topicLimiters.Load(topic)
+	if !ok {
+		topicLimiter, _ = topicLimiters.LoadOrStore(topic, newRateLimiter(topicRPS))
+	}
+	if err := topicLimiter.(*rateLimiter).Wait(ctx); err != nil {
+		return WrapError(err, "topic rate limit: "+topic)
+	}
+	return nil
+}
+
+// namespacedError hides a topic namespace prefix from the message of err, so
+// callers only see logical topic names.
+type namespacedError struct {
+	err    error
+	prefix string
+}
+
+func (e *namespacedError) Error() string {
+	return strings.ReplaceAll(e.err.Error(), e.prefix, "")
+}
+
+func (e *namespacedError) Unwrap() error {
+	return e.err
+}
+
+// withNamespace returns msg when ns is empty and otherwise a copy of msg on
+// "<ns>%<topic>", so the caller's message is never modified and can be shared
+// between concurrent sends.
+func withNamespace(ns string, msg *primitive.Message) *primitive.Message {
+	if ns == "" {
+		return msg
+	}
+	clone := msgcopy.Message(msg)
+	clone.Topic = ns + "%" + msg.Topic
+	return clone
+}
+
+// stripResultNamespace removes the "<ns>%" prefix from the queue topic of
+// result. The queue is replaced, not modified, as the SDK may share it.
+func stripResultNamespace(ns string, result *primitive.SendResult) {
+	if ns == "" || result == nil || result.MessageQueue == nil {
+		return
+	}
+	mq := *result.MessageQueue
+	mq.Topic = strings.TrimPrefix(mq.Topic, ns+"%")
+	result.MessageQueue = &mq
+}
+
+// stripNamespace wraps err so its message omits the "<ns>%" topic prefix.
+func stripNamespace(ns string, err error) error {
+	if ns == "" || err == nil {
+		return err
+	}
+	return &namespacedError{err: err, prefix: ns + "%"}
+}
@@ -0,0 +1,77 @@
+package rocketmq
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// errRateLimitDeadline is returned by rateLimiter.Wait when the wait for a
+// token would outlast the context deadline.
+var errRateLimitDeadline = errors.New("rate limit wait would exceed context deadline")
+
+// rateLimiter is a token bucket admitting rps events per second with a burst
+// of one second's worth of tokens. It stands in for golang.org/x/time/rate's
+// Limiter, whose releases require a newer go directive than this module
+// declares, and mirrors the Wait semantics the producer relies on: fail fast
+// when the wait would outlast the deadline, and return the token when the
+// wait is abandoned.
+type rateLimiter struct {
+	rps   float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter admitting rps events per second with a
+// one-second burst, or nil when rps is not positive.
+func newRateLimiter(rps float64) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	burst := math.Max(1, math.Ceil(rps))
+	return &rateLimiter{rps: rps, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait blocks until the limiter admits one event or ctx is done. It fails
+// without waiting when the wait would exceed ctx's deadline.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rps)
+	l.last = now
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rps * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+		l.cancel()
+		return errRateLimitDeadline
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// cancel returns the token reserved by an abandoned Wait.
+func (l *rateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = math.Min(l.burst, l.tokens+1)
+}
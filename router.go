@@ -0,0 +1,205 @@
+package rocketmq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/go-lynx/lynx/log"
+)
+
+// contentTypeJSON is the content type TypeRouter decodes by default, and the
+// one assumed when a message carries no Content-Type property.
+const contentTypeJSON = "application/json"
+
+// TypeRouter decodes message bodies into T and dispatches them to a handler
+// chosen by the message's Message-Type property.
+type TypeRouter[T any] struct {
+	mu       sync.RWMutex
+	handlers map[string]func(ctx context.Context, msg T) error
+	decoders map[string]func(data []byte) (T, error)
+
+	// Decoders tried in order when the content-type decoder is missing or
+	// fails, and the handler called when every decoder fails
+	fallbackDecoders []func(data []byte) (T, error)
+	onDecodeError    func(ctx context.Context, raw *primitive.MessageExt, err error)
+}
+
+// NewTypeRouter creates a TypeRouter that decodes JSON bodies.
+func NewTypeRouter[T any]() *TypeRouter[T] {
+	tr := &TypeRouter[T]{
+		handlers: make(map[string]func(ctx context.Context, msg T) error),
+		decoders: make(map[string]func(data []byte) (T, error)),
+	}
+	tr.decoders[contentTypeJSON] = func(data []byte) (T, error) {
+		var v T
+		err := json.Unmarshal(data, &v)
+		return v, err
+	}
+	return tr
+}
+
+// Register sets the handler for messageType, replacing any previous one.
+func (tr *TypeRouter[T]) Register(messageType string, handler func(ctx context.Context, msg T) error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.handlers[messageType] = handler
+}
+
+// RegisterDecoder sets the body decoder used for contentType.
+func (tr *TypeRouter[T]) RegisterDecoder(contentType string, decode func(data []byte) (T, error)) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.decoders[contentType] = decode
+}
+
+// SetDecoderFallbackChain sets decoders to try in order, until one succeeds,
+// when a message's content-type decoder is missing or fails. It helps during
+// format migrations, when a topic carries messages in several encodings.
+// WithDecoderFallbackChain does the same for any consumer handler, converting
+// bodies before they reach it.
+func (tr *TypeRouter[T]) SetDecoderFallbackChain(decoders ...func(data []byte) (T, error)) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.fallbackDecoders = append([]func(data []byte) (T, error)(nil), decoders...)
+}
+
+// SetDeserializationErrorHandler sets a handler called with the message and
+// the last decode error when no decoder can decode a message, before the
+// message is routed to the DLQ.
+func (tr *TypeRouter[T]) SetDeserializationErrorHandler(fn func(ctx context.Context, raw *primitive.MessageExt, err error)) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.onDecodeError = fn
+}
+
+// Handle decodes raw and dispatches it. Unknown types and undecodable bodies
+// cannot succeed on retry, so they are routed to the DLQ; handler errors are
+// retried.
+func (tr *TypeRouter[T]) Handle(ctx context.Context, raw *primitive.MessageExt) consumer.ConsumeResult {
+	if err := tr.HandleMessage(ctx, raw); err != nil {
+		return consumer.ConsumeRetryLater
+	}
+	return consumer.ConsumeSuccess
+}
+
+// HandleMessage is the MessageHandler form of Handle, for use with Subscribe.
+func (tr *TypeRouter[T]) HandleMessage(ctx context.Context, raw *primitive.MessageExt) error {
+	messageType := raw.GetProperty(PropertyMessageType)
+	contentType := raw.GetProperty(PropertyContentType)
+	if contentType == "" {
+		contentType = contentTypeJSON
+	}
+
+	tr.mu.RLock()
+	handler, hasHandler := tr.handlers[messageType]
+	decode, hasDecoder := tr.decoders[contentType]
+	fallbacks := tr.fallbackDecoders
+	onDecodeError := tr.onDecodeError
+	tr.mu.RUnlock()
+
+	if !hasHandler {
+		routeToDLQ(ctx)
+		log.Error("No RocketMQ handler registered for message type", "type", messageType, "topic", raw.Topic, "msgId", raw.MsgId)
+		return &ErrNoHandlerRegistered{Type: messageType}
+	}
+
+	var decoders []func(data []byte) (T, error)
+	if hasDecoder {
+		decoders = append(decoders, decode)
+	}
+	decoders = append(decoders, fallbacks...)
+
+	err := WrapError(ErrInvalidMessage, "unsupported content type: "+contentType)
+	for _, decode := range decoders {
+		msg, decodeErr := decode(raw.Body)
+		if decodeErr == nil {
+			return handler(ctx, msg)
+		}
+		err = WrapError(ErrInvalidMessage, fmt.Sprintf("failed to decode %s message: %v", contentType, decodeErr))
+	}
+
+	if onDecodeError != nil {
+		onDecodeError(ctx, raw, err)
+	}
+	routeToDLQ(ctx)
+	return err
+}
+
+// RegexRouter dispatches messages to the handler of the first route whose
+// pattern matches the message property named by the route's header key.
+type RegexRouter struct {
+	mu             sync.RWMutex
+	routes         []regexRoute
+	compiled       map[string]*regexp.Regexp
+	defaultHandler MessageHandler
+}
+
+type regexRoute struct {
+	headerKey string
+	pattern   *regexp.Regexp
+	handler   MessageHandler
+}
+
+// NewRegexRouter creates an empty RegexRouter.
+func NewRegexRouter() *RegexRouter {
+	return &RegexRouter{
+		compiled: make(map[string]*regexp.Regexp),
+	}
+}
+
+// AddRoute appends a route matching Properties[headerKey] against pattern.
+// Routes are evaluated in registration order and the first match wins.
+func (rr *RegexRouter) AddRoute(headerKey, pattern string, handler MessageHandler) error {
+	if handler == nil {
+		return WrapError(ErrConsumeMessageFailed, "route handler is nil")
+	}
+
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	re, ok := rr.compiled[pattern]
+	if !ok {
+		var err error
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			return WrapError(err, "invalid route pattern: "+pattern)
+		}
+		rr.compiled[pattern] = re
+	}
+
+	rr.routes = append(rr.routes, regexRoute{headerKey: headerKey, pattern: re, handler: handler})
+	return nil
+}
+
+// AddDefaultRoute sets the handler for messages no route matches.
+func (rr *RegexRouter) AddDefaultRoute(handler MessageHandler) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.defaultHandler = handler
+}
+
+// Handle is a MessageHandler that dispatches msg to the first matching route.
+// Without a default route, unmatched messages are routed to the DLQ.
+func (rr *RegexRouter) Handle(ctx context.Context, msg *primitive.MessageExt) error {
+	rr.mu.RLock()
+	handler := rr.defaultHandler
+	for _, route := range rr.routes {
+		if route.pattern.MatchString(msg.GetProperty(route.headerKey)) {
+			handler = route.handler
+			break
+		}
+	}
+	rr.mu.RUnlock()
+
+	if handler == nil {
+		routeToDLQ(ctx)
+		log.Error("No RocketMQ route matched message", "topic", msg.Topic, "msgId", msg.MsgId)
+		return WrapError(ErrNoRouteMatched, "message "+msg.MsgId)
+	}
+	return handler(ctx, msg)
+}
@@ -0,0 +1,163 @@
+package rocketmq
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+type orderCreated struct {
+	ID string `json:"id"`
+}
+
+// newConcurrentlyContext returns a context carrying the SDK's concurrent
+// consume context, as the push consumer supplies to consume callbacks.
+func newConcurrentlyContext() (context.Context, *primitive.ConsumeConcurrentlyContext) {
+	concurrentCtx := primitive.NewConsumeConcurrentlyContext()
+	return primitive.WithConcurrentlyCtx(context.Background(), concurrentCtx), concurrentCtx
+}
+
+func newTypedMessage(messageType string, body string) *primitive.MessageExt {
+	msg := &primitive.MessageExt{Message: primitive.Message{Topic: "orders", Body: []byte(body)}}
+	msg.WithProperty(PropertyMessageType, messageType)
+	return msg
+}
+
+func TestTypeRouterDispatchesByType(t *testing.T) {
+	router := NewTypeRouter[orderCreated]()
+	var got orderCreated
+	router.Register("order.created", func(_ context.Context, msg orderCreated) error {
+		got = msg
+		return nil
+	})
+
+	ctx, concurrentCtx := newConcurrentlyContext()
+	result := router.Handle(ctx, newTypedMessage("order.created", `{"id":"o-1"}`))
+
+	if result != consumer.ConsumeSuccess {
+		t.Fatalf("expected ConsumeSuccess, got %v", result)
+	}
+	if got.ID != "o-1" {
+		t.Fatalf("unexpected decoded message: %+v", got)
+	}
+	if concurrentCtx.DelayLevelWhenNextConsume != 0 {
+		t.Fatalf("expected no DLQ routing, got delay level %d", concurrentCtx.DelayLevelWhenNextConsume)
+	}
+}
+
+func TestTypeRouterUnknownTypeRoutesToDLQ(t *testing.T) {
+	router := NewTypeRouter[orderCreated]()
+	ctx, concurrentCtx := newConcurrentlyContext()
+
+	err := router.HandleMessage(ctx, newTypedMessage("order.deleted", `{"id":"o-1"}`))
+
+	var noHandler *ErrNoHandlerRegistered
+	if !errors.As(err, &noHandler) || noHandler.Type != "order.deleted" {
+		t.Fatalf("expected ErrNoHandlerRegistered for order.deleted, got %v", err)
+	}
+	if concurrentCtx.DelayLevelWhenNextConsume != -1 {
+		t.Fatalf("expected DLQ delay level -1, got %d", concurrentCtx.DelayLevelWhenNextConsume)
+	}
+}
+
+func TestTypeRouterHandlerErrorIsRetried(t *testing.T) {
+	router := NewTypeRouter[orderCreated]()
+	router.Register("order.created", func(context.Context, orderCreated) error {
+		return errors.New("downstream unavailable")
+	})
+	ctx, concurrentCtx := newConcurrentlyContext()
+
+	if result := router.Handle(ctx, newTypedMessage("order.created", `{"id":"o-1"}`)); result != consumer.ConsumeRetryLater {
+		t.Fatalf("expected ConsumeRetryLater, got %v", result)
+	}
+	if concurrentCtx.DelayLevelWhenNextConsume != 0 {
+		t.Fatalf("expected broker-controlled retry, got delay level %d", concurrentCtx.DelayLevelWhenNextConsume)
+	}
+}
+
+func TestRegexRouterFirstMatchWins(t *testing.T) {
+	router := NewRegexRouter()
+	var got []string
+	route := func(name string) MessageHandler {
+		return func(context.Context, *primitive.MessageExt) error {
+			got = append(got, name)
+			return nil
+		}
+	}
+
+	if err := router.AddRoute("event_type", `^order\.`, route("orders")); err != nil {
+		t.Fatalf("AddRoute failed: %v", err)
+	}
+	if err := router.AddRoute("event_type", `^order\.created$`, route("created")); err != nil {
+		t.Fatalf("AddRoute failed: %v", err)
+	}
+	if err := router.AddRoute("event_type", `(`, route("broken")); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+	router.AddDefaultRoute(route("default"))
+
+	for _, eventType := range []string{"order.created", "user.signup"} {
+		msg := &primitive.MessageExt{}
+		msg.WithProperty("event_type", eventType)
+		if err := router.Handle(context.Background(), msg); err != nil {
+			t.Fatalf("Handle(%s) failed: %v", eventType, err)
+		}
+	}
+
+	if len(got) != 2 || got[0] != "orders" || got[1] != "default" {
+		t.Fatalf("unexpected dispatch order: %v", got)
+	}
+}
+
+func TestRegexRouterUnmatchedRoutesToDLQ(t *testing.T) {
+	router := NewRegexRouter()
+	ctx, concurrentCtx := newConcurrentlyContext()
+
+	if err := router.Handle(ctx, &primitive.MessageExt{MsgId: "m-1"}); !errors.Is(err, ErrNoRouteMatched) {
+		t.Fatalf("expected ErrNoRouteMatched, got %v", err)
+	}
+	if concurrentCtx.DelayLevelWhenNextConsume != -1 {
+		t.Fatalf("expected DLQ delay level -1, got %d", concurrentCtx.DelayLevelWhenNextConsume)
+	}
+}
+
+func TestTypeRouterDecoderFallbackChain(t *testing.T) {
+	router := NewTypeRouter[orderCreated]()
+	var got []string
+	router.Register("order.created", func(_ context.Context, msg orderCreated) error {
+		got = append(got, msg.ID)
+		return nil
+	})
+	// Legacy messages carry the bare order ID.
+	router.SetDecoderFallbackChain(func(data []byte) (orderCreated, error) {
+		if len(data) == 0 || data[0] == '{' {
+			return orderCreated{}, errors.New("not a legacy message")
+		}
+		return orderCreated{ID: string(data)}, nil
+	})
+	var decodeErrs int
+	router.SetDeserializationErrorHandler(func(context.Context, *primitive.MessageExt, error) {
+		decodeErrs++
+	})
+
+	for _, body := range []string{`{"id":"o-1"}`, "o-2"} {
+		if err := router.HandleMessage(context.Background(), newTypedMessage("order.created", body)); err != nil {
+			t.Fatalf("HandleMessage(%s) failed: %v", body, err)
+		}
+	}
+	if !slices.Equal(got, []string{"o-1", "o-2"}) {
+		t.Fatalf("unexpected decoded IDs: %v", got)
+	}
+
+	ctx, concurrentCtx := newConcurrentlyContext()
+	if err := router.HandleMessage(ctx, newTypedMessage("order.created", `{"id":`)); !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrInvalidMessage when every decoder fails, got %v", err)
+	}
+	if decodeErrs != 1 || concurrentCtx.DelayLevelWhenNextConsume != -1 {
+		t.Fatalf("expected error handler call and DLQ routing, got %d calls, delay level %d", decodeErrs, concurrentCtx.DelayLevelWhenNextConsume)
+	}
+}
@@ -0,0 +1,173 @@
+// Package testutil provides in-memory stand-ins for RocketMQ clients, for
+// testing message handlers without a broker.
+package testutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/go-lynx/lynx-rocketmq/internal/msgcopy"
+)
+
+var (
+	// ErrNotStarted is returned by Poll before Start or after Shutdown.
+	ErrNotStarted = errors.New("virtual consumer is not started")
+	// ErrNotSubscribed is returned by Poll when the consumer's topic has no
+	// subscription.
+	ErrNotSubscribed = errors.New("virtual consumer topic is not subscribed")
+)
+
+// VirtualConsumer is a rocketmq.PushConsumer that delivers a fixed list of
+// messages to its subscription, one per Poll call, and records whether each
+// was acknowledged. Each consumer group gets its own VirtualConsumer, so
+// group isolation can be tested by creating one per group.
+type VirtualConsumer struct {
+	group string
+	topic string
+
+	mu        sync.Mutex
+	pending   []*primitive.MessageExt
+	callback  func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error)
+	started   bool
+	suspended bool
+	acked     []*primitive.MessageExt
+	nacked    []*primitive.MessageExt
+}
+
+var _ rocketmq.PushConsumer = (*VirtualConsumer)(nil)
+
+// NewVirtualConsumer creates a consumer for group that delivers msgs on topic
+// in order, skipping nil entries. Messages without a topic are delivered as a
+// copy assigned topic; msgs itself is not modified.
+func NewVirtualConsumer(group, topic string, msgs []*primitive.MessageExt) *VirtualConsumer {
+	pending := make([]*primitive.MessageExt, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg == nil {
+			continue
+		}
+		if msg.Topic == "" {
+			msg = msgcopy.Ext(msg)
+			msg.Topic = topic
+		}
+		pending = append(pending, msg)
+	}
+	return &VirtualConsumer{group: group, topic: topic, pending: pending}
+}
+
+// Start implements rocketmq.PushConsumer.
+func (c *VirtualConsumer) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.started = true
+	return nil
+}
+
+// Shutdown implements rocketmq.PushConsumer.
+func (c *VirtualConsumer) Shutdown() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.started = false
+	return nil
+}
+
+// Subscribe implements rocketmq.PushConsumer. Only the consumer's own topic
+// receives messages; the selector is ignored.
+func (c *VirtualConsumer) Subscribe(topic string, _ consumer.MessageSelector, f func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if topic == c.topic {
+		c.callback = f
+	}
+	return nil
+}
+
+// Unsubscribe implements rocketmq.PushConsumer.
+func (c *VirtualConsumer) Unsubscribe(topic string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if topic == c.topic {
+		c.callback = nil
+	}
+	return nil
+}
+
+// Suspend implements rocketmq.PushConsumer; Poll delivers nothing until Resume.
+func (c *VirtualConsumer) Suspend() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.suspended = true
+}
+
+// Resume implements rocketmq.PushConsumer.
+func (c *VirtualConsumer) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.suspended = false
+}
+
+// GetOffsetDiffMap implements rocketmq.PushConsumer and reports the number of
+// undelivered messages for the topic.
+func (c *VirtualConsumer) GetOffsetDiffMap() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return map[string]int64{c.topic: int64(len(c.pending))}
+}
+
+// Poll delivers the next message to the subscription callback and records
+// the outcome. It reports false when there was nothing to deliver, either
+// because all messages were delivered or because the consumer is suspended.
+// A message whose callback returns ConsumeRetryLater is nacked and not
+// redelivered.
+func (c *VirtualConsumer) Poll() (bool, error) {
+	c.mu.Lock()
+	if !c.started {
+		c.mu.Unlock()
+		return false, ErrNotStarted
+	}
+	if c.callback == nil {
+		c.mu.Unlock()
+		return false, ErrNotSubscribed
+	}
+	if c.suspended || len(c.pending) == 0 {
+		c.mu.Unlock()
+		return false, nil
+	}
+	msg := c.pending[0]
+	c.pending = c.pending[1:]
+	callback := c.callback
+	c.mu.Unlock()
+
+	ctx := primitive.WithConcurrentlyCtx(context.Background(), primitive.NewConsumeConcurrentlyContext())
+	ctx = primitive.WithConsumerCtx(ctx, &primitive.ConsumeMessageContext{
+		ConsumerGroup: c.group,
+		Msgs:          []*primitive.MessageExt{msg},
+	})
+	result, err := callback(ctx, msg)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil && result == consumer.ConsumeSuccess {
+		c.acked = append(c.acked, msg)
+	} else {
+		c.nacked = append(c.nacked, msg)
+	}
+	return true, nil
+}
+
+// Acknowledged returns the messages consumed successfully, in delivery order.
+func (c *VirtualConsumer) Acknowledged() []*primitive.MessageExt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*primitive.MessageExt(nil), c.acked...)
+}
+
+// Nacked returns the messages whose consumption failed, in delivery order.
+func (c *VirtualConsumer) Nacked() []*primitive.MessageExt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*primitive.MessageExt(nil), c.nacked...)
+}
@@ -0,0 +1,81 @@
+package testutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+func TestVirtualConsumerDeliversInOrder(t *testing.T) {
+	msgs := []*primitive.MessageExt{{MsgId: "m-1"}, {MsgId: "m-2"}, {MsgId: "m-3"}}
+	vc := NewVirtualConsumer("billing", "orders", msgs)
+
+	if _, err := vc.Poll(); !errors.Is(err, ErrNotStarted) {
+		t.Fatalf("expected ErrNotStarted, got %v", err)
+	}
+
+	var delivered []string
+	_ = vc.Subscribe("orders", consumer.MessageSelector{}, func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		if consumeCtx, ok := primitive.GetConsumerCtx(ctx); !ok || consumeCtx.ConsumerGroup != "billing" {
+			t.Errorf("expected consumer group billing in context")
+		}
+		delivered = append(delivered, msgs[0].MsgId)
+		if msgs[0].MsgId == "m-2" {
+			return consumer.ConsumeRetryLater, errors.New("failed")
+		}
+		return consumer.ConsumeSuccess, nil
+	})
+	_ = vc.Start()
+
+	for {
+		ok, err := vc.Poll()
+		if err != nil {
+			t.Fatalf("Poll failed: %v", err)
+		}
+		if !ok {
+			break
+		}
+	}
+
+	if len(delivered) != 3 || delivered[0] != "m-1" || delivered[2] != "m-3" {
+		t.Fatalf("unexpected delivery order: %v", delivered)
+	}
+	if acked := vc.Acknowledged(); len(acked) != 2 || acked[1].MsgId != "m-3" || acked[1].Topic != "orders" {
+		t.Fatalf("unexpected acknowledged messages: %v", acked)
+	}
+	if nacked := vc.Nacked(); len(nacked) != 1 || nacked[0].MsgId != "m-2" {
+		t.Fatalf("unexpected nacked messages: %v", nacked)
+	}
+	for _, msg := range msgs {
+		if msg.Topic != "" {
+			t.Fatalf("expected caller's message %s to keep its empty topic, got %q", msg.MsgId, msg.Topic)
+		}
+	}
+}
+
+func TestVirtualConsumerSkipsNilMessages(t *testing.T) {
+	vc := NewVirtualConsumer("billing", "orders", []*primitive.MessageExt{nil, {MsgId: "m-1"}, nil})
+	if pending := vc.GetOffsetDiffMap()["orders"]; pending != 1 {
+		t.Fatalf("expected 1 pending message, got %d", pending)
+	}
+
+	_ = vc.Subscribe("orders", consumer.MessageSelector{}, func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		return consumer.ConsumeSuccess, nil
+	})
+	_ = vc.Start()
+	for {
+		ok, err := vc.Poll()
+		if err != nil {
+			t.Fatalf("Poll failed: %v", err)
+		}
+		if !ok {
+			break
+		}
+	}
+	if acked := vc.Acknowledged(); len(acked) != 1 || acked[0].MsgId != "m-1" {
+		t.Fatalf("unexpected acknowledged messages: %v", acked)
+	}
+}
@@ -0,0 +1,98 @@
+package rocketmq
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+)
+
+// WeightedTopicSelector picks a destination topic with probability
+// proportional to its weight, e.g. to shift a fraction of traffic to a new
+// topic version during a blue/green rollout. WithTopicSelector applies it to
+// every message a producer sends without a topic; Select can also be called
+// directly:
+//
+//	selector, _ := NewWeightedTopicSelector(map[string]int{"orders-v1": 90, "orders-v2": 10})
+//	err := client.SendMessage(ctx, selector.Select(), body)
+type WeightedTopicSelector struct {
+	mu         sync.RWMutex
+	topics     []string
+	cumulative []int
+	total      int
+}
+
+// NewWeightedTopicSelector creates a selector from a topic → weight map.
+// Topics with zero weight are kept out of rotation.
+func NewWeightedTopicSelector(weights map[string]int) (*WeightedTopicSelector, error) {
+	s := &WeightedTopicSelector{}
+	if err := s.SetWeights(weights); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetWeights atomically replaces the weight table. Weights must be
+// non-negative and at least one must be positive.
+func (s *WeightedTopicSelector) SetWeights(weights map[string]int) error {
+	topics := make([]string, 0, len(weights))
+	for topic, weight := range weights {
+		if err := validateTopic(topic); err != nil {
+			return WrapError(err, "invalid weighted topic: "+topic)
+		}
+		if weight < 0 {
+			return WrapError(ErrInvalidTopicWeight, fmt.Sprintf("negative weight %d for topic %s", weight, topic))
+		}
+		if weight > 0 {
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) == 0 {
+		return WrapError(ErrInvalidTopicWeight, "at least one topic must have a positive weight")
+	}
+
+	// Sort so selection is stable for a given random draw.
+	sort.Strings(topics)
+	cumulative := make([]int, len(topics))
+	total := 0
+	for i, topic := range topics {
+		total += weights[topic]
+		cumulative[i] = total
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.topics = topics
+	s.cumulative = cumulative
+	s.total = total
+	return nil
+}
+
+// Select returns the topic for the next send, or "" when no weights have
+// been set, e.g. on a zero-value selector; sending to "" fails topic
+// validation.
+func (s *WeightedTopicSelector) Select() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.total == 0 {
+		return ""
+	}
+	n := rand.IntN(s.total)
+	i := sort.SearchInts(s.cumulative, n+1)
+	return s.topics[i]
+}
+
+// Weights returns the effective weights of the topics currently in rotation.
+func (s *WeightedTopicSelector) Weights() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	weights := make(map[string]int, len(s.topics))
+	prev := 0
+	for i, topic := range s.topics {
+		weights[topic] = s.cumulative[i] - prev
+		prev = s.cumulative[i]
+	}
+	return weights
+}
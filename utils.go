@@ -1,6 +1,10 @@
 package rocketmq
 
 import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -49,6 +53,24 @@ func validateGroupName(groupName string) error {
 	return nil
 }
 
+// validateNameServerAddr validates a NameServer address in host:port form
+func validateNameServerAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return WrapError(ErrInvalidNameServer, err.Error())
+	}
+
+	if host == "" {
+		return WrapError(ErrInvalidNameServer, "missing host in address: "+addr)
+	}
+
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return WrapError(ErrInvalidNameServer, "invalid port in address: "+addr)
+	}
+
+	return nil
+}
+
 // validateConsumeModel validates consume model
 func validateConsumeModel(model string) error {
 	switch model {
@@ -90,3 +112,13 @@ func consumerPullInterval(d *durationpb.Duration) time.Duration {
 	}
 	return parseDuration(defaultPullInterval, 100*time.Millisecond)
 }
+
+// isTimeoutError reports whether err is a context deadline or a net-style
+// timeout error, such as a dial or I/O deadline expiry.
+func isTimeoutError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}